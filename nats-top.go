@@ -7,12 +7,16 @@ import (
 	"log"
 	"net"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-top/ui"
 	top "github.com/nats-io/nats-top/util"
-	ui "gopkg.in/gizak/termui.v1"
 )
 
 var (
@@ -21,12 +25,21 @@ var (
 	conns                      = flag.Int("n", 1024, "Maximum number of connections to poll.")
 	delay                      = flag.Int("d", 1, "Refresh interval in seconds.")
 	sortBy                     = flag.String("sort", "cid", "Value for which to sort by the connections.")
+	orderByOpt                 = flag.String("order", "", "Column by which to order the polled connections, including the rates.")
+	columnsOpt                 = flag.String("columns", "", "Comma separated columns of the connections table, e.g. host,cid,account,rtt, or columns to show or hide with a + or - prefix, e.g. +account,-lang.")
+	groupByOpt                 = flag.String("group-by", "", "Aggregate the connections by name, ip, account or lang.")
 	lookupDNS                  = flag.Bool("lookup", false, "Enable client addresses DNS lookup.")
 	outputFile                 = flag.String("o", "", "Save the very first nats-top snapshot to the given file and exit. If '-' is passed then the snapshot is printed the standard output.")
 	showVersion                = false
 	outputDelimiter            = flag.String("l", "", "Specifies the delimiter to use for the output file when the '-o' parameter is used. By default this option is unset which means that standard grid-like plain-text output will be used.")
 	displayRawBytes            = flag.Bool("b", false, "Display traffic in raw bytes.")
 	maxStatsRefreshes          = flag.Int("r", -1, "Specifies the maximum number of times nats-top should refresh nats-stats before exiting.")
+	requestTimeout             = flag.Duration("timeout", top.DefaultTimeout, "Timeout for each request to the monitoring endpoint.")
+	maxBackoff                 = flag.Duration("max-backoff", top.DefaultMaxBackoff, "Maximum delay between polls when the monitoring endpoint is unreachable.")
+	historySize                = flag.Int("history", top.DefaultHistorySize, "Number of snapshots to keep in the history, 0 for no limit.")
+	historyDuration            = flag.Duration("history-duration", 0, "How long to keep snapshots in the history, 0 for no limit.")
+	highRTT                    = flag.Duration("rtt-threshold", top.DefaultHighRTT, "Round trip time from which connections are highlighted as having high latency.")
+	thresholdsOpt              = flag.String("thresholds", "", "Comma separated thresholds from which values are highlighted, as metric=warning[:critical] for pending, idle, msgs, rtt, cpu and mem, e.g. pending=1MB:10MB,msgs=1000.")
 	displaySubscriptionsColumn = false
 
 	// Secure options
@@ -35,13 +48,21 @@ var (
 	keyOpt        = flag.String("key", "", "Client private key in case NATS server using TLS")
 	caCertOpt     = flag.String("cacert", "", "Root CA cert")
 	skipVerifyOpt = flag.Bool("k", false, "Skip verifying server certificate")
+	serverNameOpt = flag.String("tls-server-name", "", "Server name used for SNI and verifying the server certificate")
+	minVersionOpt = flag.String("tls-min-version", "", "Minimum TLS version to accept: 1.0, 1.1, 1.2 or 1.3")
+	sysRootsOpt   = flag.Bool("tls-system-roots", false, "Trust the system root CAs in addition to the one given via -cacert")
+	contextName   = flag.String("context", "", "Read the server host and TLS settings from the given nats CLI context, or the selected one if empty.")
 
 	version = "0.0.0"
 )
 
 const usageHelp = `
-usage: nats-top [-s server] [-m http_port] [-ms https_port] [-n num_connections] [-d delay_secs] [-r max] [-o FILE] [-l DELIMITER] [-sort by]
+usage: nats-top [-s server] [-m http_port] [-ms https_port] [-n num_connections] [-d delay_secs] [-r max] [-o FILE] [-l DELIMITER] [-sort by] [-order column] [-group-by field]
                 [-cert FILE] [-key FILE] [-cacert FILE] [-k] [-b] [-v|--version] [-u|--display-subscriptions-column]
+                [-tls-server-name name] [-tls-min-version version] [-tls-system-roots]
+                [-timeout duration] [-max-backoff duration] [--context name]
+                [-history num_snapshots] [-history-duration duration] [-rtt-threshold duration]
+                [-columns list] [-thresholds list]
 
 `
 
@@ -67,18 +88,44 @@ func main() {
 		os.Exit(0)
 	}
 
+	// An empty context name is the selected context, so -context ""
+	// is told apart from the flag not being set at all
+	contextSet := false
+	flag.Visit(func(f *flag.Flag) { contextSet = contextSet || f.Name == "context" })
+	if contextSet {
+		if err := applyNATSContext(*contextName); err != nil {
+			fmt.Fprintf(os.Stderr, "nats-top: %s", err)
+			usage()
+		}
+	}
+
 	var engine *top.Engine
 
 	// Use secure port if set explicitly, otherwise use http port by default
 	if *httpsPort != 0 {
 		engine = top.NewEngine(*host, *httpsPort, *conns, *delay)
-		err := engine.SetupHTTPS(*caCertOpt, *certOpt, *keyOpt, *skipVerifyOpt)
+		engine.Timeout = *requestTimeout
+		engine.MaxBackoff = *maxBackoff
+		minVersion, err := top.ParseTLSVersion(*minVersionOpt)
+		if err == nil {
+			err = engine.SetupHTTPSWithOptions(&top.TLSOptions{
+				CACert:      *caCertOpt,
+				Cert:        *certOpt,
+				Key:         *keyOpt,
+				SkipVerify:  *skipVerifyOpt,
+				ServerName:  *serverNameOpt,
+				MinVersion:  minVersion,
+				SystemRoots: *sysRootsOpt,
+			})
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "nats-top: %s", err)
 			usage()
 		}
 	} else {
 		engine = top.NewEngine(*host, *port, *conns, *delay)
+		engine.Timeout = *requestTimeout
+		engine.MaxBackoff = *maxBackoff
 		engine.SetupHTTP()
 	}
 
@@ -92,6 +139,11 @@ func main() {
 		usage()
 	}
 
+	if *delay < 1 {
+		fmt.Fprintf(os.Stderr, "nats-top: refresh interval must be at least 1 second: %d\n", *delay)
+		usage()
+	}
+
 	// Smoke test to abort in case can't connect to server since the beginning.
 	_, err := engine.Request("/varz")
 	if err != nil {
@@ -99,31 +151,122 @@ func main() {
 		usage()
 	}
 
-	sortOpt := server.SortOpt(*sortBy)
+	if *historySize <= 0 && *historyDuration <= 0 {
+		fmt.Fprintf(os.Stderr, "nats-top: history must be bounded by -history or -history-duration\n")
+		usage()
+	}
+	engine.History = top.NewHistory(*historySize, *historyDuration)
+
+	sortName, sortDirection := top.SplitDirection(*sortBy)
+	sortOpt := server.SortOpt(sortName)
 	if !sortOpt.IsValid() {
 		fmt.Fprintf(os.Stderr, "nats-top: invalid option to sort by: %s\n", sortOpt)
 		usage()
 	}
 	engine.SortOpt = sortOpt
+	engine.SortDirection = sortDirection
+
+	orderName, orderDirection := top.SplitDirection(*orderByOpt)
+	orderBy = top.Column(orderName)
+	if !orderBy.IsValid() {
+		fmt.Fprintf(os.Stderr, "nats-top: invalid column to order by: %s\n", orderBy)
+		usage()
+	}
+	orderDir = orderDirection
+
+	groupBy = top.GroupBy(*groupByOpt)
+	if !groupBy.IsValid() {
+		fmt.Fprintf(os.Stderr, "nats-top: invalid option to group by: %s\n", groupBy)
+		usage()
+	}
+
+	// The high latency threshold can be set on its own as well
+	thresholds[top.ThresholdRTT] = top.Threshold{Warning: highRTT.Seconds(), Critical: thresholds[top.ThresholdRTT].Critical}
+	if *thresholdsOpt != "" {
+		thresholds, err = top.ParseThresholds(*thresholdsOpt, thresholds)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "nats-top: %s\n", err)
+			usage()
+		}
+	}
+
+	// The columns chosen in the command line take precedence over the saved ones
+	if *columnsOpt != "" {
+		displayColumns, err = top.ParseColumns(*columnsOpt, top.DefaultColumns)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "nats-top: %s\n", err)
+			usage()
+		}
+	} else if columns, err := top.LoadColumns(columnsFile()); err == nil {
+		displayColumns = columns
+	}
 
 	if displaySubscriptionsColumn {
 		engine.DisplaySubs = true
 	}
+	engine.SetAccounts(displaysAccounts())
 
 	if *outputFile != "" {
 		saveStatsSnapshotToFile(engine, outputFile, *outputDelimiter)
 		return
 	}
 
-	err = ui.Init()
+	renderer := ui.NewTcellRenderer(nil)
+	err = renderer.Init()
 	if err != nil {
 		panic(err)
 	}
-	defer ui.Close()
+	defer renderer.Close()
 
 	go engine.MonitorStats()
 
-	StartUI(engine)
+	StartUI(engine, renderer)
+}
+
+// columnsFile returns the file where the columns chosen with the column
+// chooser are saved, or an empty string if there is no config directory.
+func columnsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "nats-top", "columns")
+}
+
+// applyNATSContext fills the connection options that were not explicitly
+// set in the command line from the given nats CLI context.
+func applyNATSContext(name string) error {
+	nctx, err := top.LoadNATSContext(name)
+	if err != nil {
+		return err
+	}
+
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	if !explicit["s"] {
+		h, err := nctx.MonitoringHost()
+		if err != nil {
+			return err
+		}
+		*host = h
+	}
+
+	if !explicit["cacert"] {
+		*caCertOpt = nctx.CA
+	}
+	if !explicit["cert"] && !explicit["key"] {
+		*certOpt = nctx.Cert
+		*keyOpt = nctx.Key
+	}
+
+	// Poll via https on the monitoring port with the TLS settings of the
+	// context, if it has any, unless a port was given
+	if nctx.UseTLS() && !explicit["ms"] && !explicit["m"] {
+		*httpsPort = *port
+	}
+
+	return nil
 }
 
 func saveStatsSnapshotToFile(engine *top.Engine, outputFile *string, outputDelimiter string) {
@@ -147,17 +290,9 @@ func saveStatsSnapshotToFile(engine *top.Engine, outputFile *string, outputDelim
 	f.Close() //no point to error check    process will exit anyway
 }
 
-// clearScreen tries to ensure resetting original state of screen
-func clearScreen() {
-	fmt.Print("\033[2J\033[1;1H\033[?25l")
-}
-
-func cleanExit() {
-	clearScreen()
-	ui.Close()
-
-	// Show cursor once again
-	fmt.Print("\033[?25h")
+// cleanExit gives the terminal back in its original state and exits.
+func cleanExit(renderer ui.Renderer) {
+	renderer.Close()
 	os.Exit(0)
 }
 
@@ -180,22 +315,121 @@ const (
 	DEFAULT_PADDING_SIZE      = 2
 	DEFAULT_PADDING           = "  "
 	DEFAULT_HOST_PADDING_SIZE = 15
-	UI_HEADER_PREFIX          = "\033[1;1H\033[7;1H"
+	DEFAULT_SPARKLINE_WIDTH   = 30
+	PENDING_WARNING_MARKER    = '!'
+	MAX_PENDING_WARNINGS      = 5 // connections listed with pending growing, the rest only counted
+	HIGH_RTT_MARKER           = '~'
+	MAX_SPARKLINE_WIDTH       = 60
+	MOUSE_WHEEL_ROWS          = 3 // scrolled at once by the mouse wheel
+	INSTANT_RATES             = -1
 )
 
 var (
-	resolvedHosts = map[string]string{} // cache for reducing DNS lookups in case enabled
-
-	standardHeaders = []interface{}{"SUBS", "PENDING", "MSGS_TO", "MSGS_FROM", "BYTES_TO", "BYTES_FROM", "LANG", "VERSION", "UPTIME", "LAST_ACTIVITY"}
+	resolver = top.NewResolver(net.LookupAddr) // of the host names of the clients in case DNS lookup is enabled
+
+	showTrends       = true // sparklines of the server metrics in the header
+	sparklineWidth   = DEFAULT_SPARKLINE_WIDTH
+	showDistribution = true            // min, median, p90, p99 and max across connections
+	rateWindow       = INSTANT_RATES   // or the index of the moving average shown as connection rates
+	groupBy          = top.GroupByNone // field to aggregate connections by, if any
+	orderBy          = top.ColumnNone  // column to order the polled connections by, if not as sorted by the server
+	orderDir         = top.DirectionDefault
+
+	displayColumns = slices.Clone(top.DefaultColumns) // of the connections table, in the order they are displayed
+	thresholds     = top.DefaultThresholds()          // from which values are highlighted
+
+	// Headers of the columns of the connections table, the one they are ordered by getting an arrow for the direction
+	columnHeaders = map[top.Column]string{
+		top.ColumnHost:      "HOST",
+		top.ColumnCid:       "CID",
+		top.ColumnName:      "NAME",
+		top.ColumnAccount:   "ACCOUNT",
+		top.ColumnKind:      "KIND",
+		top.ColumnSubs:      "SUBS",
+		top.ColumnPending:   "PENDING",
+		top.ColumnMsgsTo:    "MSGS_TO",
+		top.ColumnMsgsFrom:  "MSGS_FROM",
+		top.ColumnBytesTo:   "BYTES_TO",
+		top.ColumnBytesFrom: "BYTES_FROM",
+		top.ColumnRTT:       "RTT",
+		top.ColumnTLS:       "TLS",
+		top.ColumnLang:      "LANG",
+		top.ColumnVersion:   "VERSION",
+		top.ColumnUptime:    "UPTIME",
+		top.ColumnLast:      "LAST_ACTIVITY",
+	}
 
-	defaultHeaderColumns = []string{"%-6s", "%-10s", "%-10s", "%-10s", "%-10s", "%-10s", "%-7s", "%-7s", "%-7s", "%-40s"} // Chopped: HOST CID NAME...
-	defaultRowColumns    = []string{"%-6d", "%-10s", "%-10s", "%-10s", "%-10s", "%-10s", "%-7s", "%-7s", "%-7s", "%-40s"}
+	// Minimum widths of the columns of the connections table, which are as wide as their values
+	columnWidths = map[top.Column]int{
+		top.ColumnHost:      DEFAULT_HOST_PADDING_SIZE,
+		top.ColumnCid:       6,
+		top.ColumnSubs:      6,
+		top.ColumnPending:   10,
+		top.ColumnMsgsTo:    10,
+		top.ColumnMsgsFrom:  10,
+		top.ColumnBytesTo:   10,
+		top.ColumnBytesFrom: 10,
+		top.ColumnRTT:       9,
+		top.ColumnTLS:       4,
+		top.ColumnLang:      7,
+		top.ColumnVersion:   8,
+		top.ColumnUptime:    7,
+		top.ColumnLast:      40,
+	}
 )
 
 func generateParagraphPlainText(
 	engine *top.Engine,
 	stats *top.Stats,
 ) string {
+	text, table := generateTopView(engine, engine.History, stats)
+	return text + table.String()
+}
+
+// connsTable is the table of connections, or of groups of them,
+// below the header of the top view.
+type connsTable struct {
+	header string
+	rows   []string
+	cids   []uint64 // of the connection in each row, unless grouped
+
+	// The values past their thresholds in each row and the highest
+	// level of them, unless grouped.
+	spans  [][]ui.Span
+	levels []top.Level
+
+	// The columns of the table and where each one starts, unless grouped.
+	columns []top.Column
+	starts  []int
+}
+
+// columnAt returns the column of the table at x, if there is one.
+func (t *connsTable) columnAt(x int) (top.Column, bool) {
+	for j := len(t.starts) - 1; j >= 0; j-- {
+		if x >= t.starts[j] {
+			return t.columns[j], true
+		}
+	}
+	return top.ColumnNone, false
+}
+
+func (t *connsTable) String() string {
+	return t.header + strings.Join(t.rows, "")
+}
+
+// generateTopView returns the header of the top view with the server
+// stats and the table of connections below it.
+func generateTopView(
+	engine *top.Engine,
+	history *top.History,
+	stats *top.Stats,
+) (string, *connsTable) {
+
+	// Only the connections matching the filter are displayed
+	filter := engine.Filter()
+	if filter != nil {
+		stats = filter.Filter(stats)
+	}
 
 	// Snapshot current stats
 	cpu := stats.Varz.CPU
@@ -236,174 +470,543 @@ func generateParagraphPlainText(
 	info += "  Out:  Msgs: %s  Bytes: %s  Msgs/Sec: %.1f  Bytes/Sec: %s"
 
 	text := fmt.Sprintf(
-		info, serverVersion, uptime, stats.Error,
+		info, serverVersion, uptime, pollStatus(stats),
 		serverName, serverID,
 		cpu, mem, slowConsumers,
 		inMsgs, inBytes, inMsgsRate, inBytesRate,
 		outMsgs, outBytes, outMsgsRate, outBytesRate,
 	)
 
-	text += fmt.Sprintf("\n\nConnections Polled: %d\n", numConns)
-	displaySubs := engine.DisplaySubs
+	// The averages need earlier polls, which a single snapshot lacks
+	if history.Len() >= 2 {
+		avg := stats.Rates.Averages
+		averages := func(size func(bool, int64) string, values [3]float64) string {
+			return fmt.Sprintf("%s, %s, %s",
+				size(*displayRawBytes, int64(values[top.Avg1m])),
+				size(*displayRawBytes, int64(values[top.Avg5m])),
+				size(*displayRawBytes, int64(values[top.Avg15m])))
+		}
+		text += fmt.Sprintf("\n  Avg In:   Msgs/Sec: %s  Bytes/Sec: %s  (1m, 5m, 15m)",
+			averages(top.Nsize, avg.InMsgsRate), averages(top.Psize, avg.InBytesRate))
+		text += fmt.Sprintf("\n  Avg Out:  Msgs/Sec: %s  Bytes/Sec: %s",
+			averages(top.Nsize, avg.OutMsgsRate), averages(top.Psize, avg.OutBytesRate))
+	}
 
-	header := make([]interface{}, 0) // Dynamically add columns and padding depending
-	hostSize := DEFAULT_HOST_PADDING_SIZE
+	if trends := generateTrends(history); trends != "" {
+		text += "\n\n" + trends
+	}
 
-	nameSize := 0 // Disable name unless we have seen one using it
-	for _, conn := range stats.Connz.Conns {
-		var size int
-
-		var hostname string
-		if *lookupDNS {
-			if addr, present := resolvedHosts[conn.IP]; !present { // Make a lookup for each one of the ips and memoize them for subsequent polls
-				addrs, err := net.LookupAddr(conn.IP)
-				if err == nil && len(addrs) > 0 && len(addrs[0]) > 0 {
-					hostname = addrs[0]
-					resolvedHosts[conn.IP] = hostname
-				} else {
-					// Otherwise just continue to use ip:port as resolved host
-					// can be an empty string even though there were no errors
-					hostname = fmt.Sprintf("%s:%d", conn.IP, conn.Port)
-					resolvedHosts[conn.IP] = hostname
-				}
-			} else {
-				hostname = addr
-			}
-		} else {
-			hostname = fmt.Sprintf("%s:%d", conn.IP, conn.Port)
+	text += fmt.Sprintf("\n\nConnections Polled: %d", numConns)
+	if engine.ShowRates {
+		text += fmt.Sprintf("  (rates: %s)", rateWindowName())
+	}
+	if filter != nil {
+		text += fmt.Sprintf("  Matching %q: %d", filter.Pattern, len(stats.Connz.Conns))
+	}
+	if stats.Churn != nil {
+		text += generateChurn(stats.Churn)
+	}
+	text += "\n"
+
+	if warnings := generatePendingWarnings(stats); warnings != "" {
+		text += warnings
+	}
+
+	if showDistribution && len(stats.Connz.Conns) > 0 {
+		text += generateDistribution(stats)
+	}
+
+	if groupBy != top.GroupByNone {
+		return text, generateGroups(stats, "")
+	}
+
+	conns := top.OrderConns(stats, orderBy, orderDir.IsDescending(orderBy.Descending()), engine.ShowRates, rateWindow)
+
+	return text, generateConnsTable(engine, stats, conns)
+}
+
+// pollStatus describes whether the last poll failed, or else when the
+// server was last restarted, if it was.
+func pollStatus(stats *top.Stats) string {
+	status := fmt.Sprint(stats.Error)
+	if stats.RetryIn > 0 {
+		status = fmt.Sprintf("disconnected — retrying in %s (%s)", stats.RetryIn, stats.Error)
+	} else if !stats.LastRestart.IsZero() {
+		status = fmt.Sprintf("server restarted at %s", stats.LastRestart.Format(time.TimeOnly))
+	}
+	return status
+}
+
+// generateConnsTable returns the table of connections with the chosen
+// columns, each one as wide as its widest value.
+func generateConnsTable(engine *top.Engine, stats *top.Stats, conns []*server.ConnInfo) *connsTable {
+	var columns []top.Column
+	for _, column := range displayColumns {
+		// Disable name unless we have seen one using it
+		if column == top.ColumnName && !slices.ContainsFunc(conns, func(conn *server.ConnInfo) bool { return conn.Name != "" }) {
+			continue
 		}
+		columns = append(columns, column)
+	}
 
-		size = len(hostname) // host
-		if size > hostSize {
-			hostSize = size + DEFAULT_PADDING_SIZE
+	// The arrow on the column the connections are ordered by is only
+	// displayed, keeping the header of the output file as it is
+	orderColumn, desc := displayOrder(engine)
+	arrow := "↑"
+	if desc {
+		arrow = "↓"
+	}
+	if *outputFile != "" {
+		orderColumn, arrow = top.ColumnNone, ""
+	}
+
+	header := make([]string, len(columns))
+	widths := make([]int, len(columns))
+	for j, column := range columns {
+		header[j] = columnHeaders[column]
+		if column == orderColumn {
+			header[j] += arrow
 		}
+		// Leave room for the arrow, whichever column it is on
+		widths[j] = max(columnWidths[column], len(columnHeaders[column])+utf8.RuneCountInString(arrow))
+	}
+
+	values := make([][]string, len(conns))
+	for i, conn := range conns {
+		values[i] = make([]string, len(columns))
+		for j, column := range columns {
+			values[i][j] = connValue(stats, conn, column, engine.ShowRates)
+			widths[j] = max(widths[j], utf8.RuneCountInString(values[i][j]))
+		}
+	}
+
+	line := func(values []string, subs string) string {
+		var b strings.Builder
+		b.WriteString(DEFAULT_PADDING)
+		for j, v := range values {
+			fmt.Fprintf(&b, "%-*s  ", widths[j], v)
+		}
+		if engine.DisplaySubs {
+			b.WriteString(subs)
+		}
+		return strings.TrimRight(b.String(), " ") + "\n"
+	}
 
-		size = len(conn.Name) // name
-		if size > nameSize {
-			nameSize = size + DEFAULT_PADDING_SIZE
+	// Where each column starts in the rows, for highlighting its values
+	starts := make([]int, len(columns))
+	start := len(DEFAULT_PADDING)
+	for j := range columns {
+		starts[j] = start
+		start += widths[j] + 2
+	}
+
+	table := &connsTable{header: line(header, "SUBSCRIPTIONS"), columns: columns, starts: starts}
+	for i, conn := range conns {
+		crate := stats.Rates.Connections[conn.Cid]
+		levels := thresholds.ConnLevels(conn, crate, stats.Connz.Now)
+
+		connLine := line(values[i], strings.Join(conn.Subs, ", "))
+		if crate != nil && crate.Pending.Warning() {
+			connLine = string(PENDING_WARNING_MARKER) + connLine[1:]
+		} else if levels[top.ColumnRTT] != top.LevelNormal {
+			connLine = string(HIGH_RTT_MARKER) + connLine[1:]
+		}
 
-			minLen := len("NAME") // If using name, ensure that it is not too small...
-			if nameSize < minLen {
-				nameSize = minLen
+		var spans []ui.Span
+		rowLevel := top.LevelNormal
+		for j, column := range columns {
+			if level := levels[column]; level != top.LevelNormal {
+				end := starts[j] + utf8.RuneCountInString(values[i][j])
+				spans = append(spans, ui.Span{Start: starts[j], End: end, Style: levelStyles[level]})
+				rowLevel = max(rowLevel, level)
 			}
 		}
+
+		table.rows = append(table.rows, connLine)
+		table.cids = append(table.cids, conn.Cid)
+		table.spans = append(table.spans, spans)
+		table.levels = append(table.levels, rowLevel)
 	}
 
-	connHeader := DEFAULT_PADDING // Initial padding
+	return table
+}
 
-	header = append(header, "HOST") // HOST
-	connHeader += "%-" + fmt.Sprintf("%d", hostSize) + "s "
+// connValue returns the value of a column for a connection as displayed,
+// which for the msgs and bytes columns are their rates when showRates is
+// set, over the chosen window.
+func connValue(stats *top.Stats, conn *server.ConnInfo, column top.Column, showRates bool) string {
+	var rates top.ConnRates
+	if crate := stats.Rates.Connections[conn.Cid]; crate != nil {
+		rates = crate.Windowed(rateWindow)
+	}
 
-	header = append(header, "CID") // CID
-	connHeader += " %-6s "
+	switch column {
+	case top.ColumnHost:
+		return connHost(conn)
+	case top.ColumnCid:
+		return fmt.Sprint(conn.Cid)
+	case top.ColumnName:
+		return conn.Name
+	case top.ColumnAccount:
+		return top.ConnAccount(conn)
+	case top.ColumnKind:
+		return conn.Kind
+	case top.ColumnSubs:
+		return fmt.Sprint(conn.NumSubs)
+	case top.ColumnPending:
+		return top.Nsize(*displayRawBytes, int64(conn.Pending))
+	case top.ColumnMsgsTo:
+		if showRates {
+			return top.Nsize(*displayRawBytes, int64(rates.OutMsgsRate))
+		}
+		return top.Nsize(*displayRawBytes, conn.OutMsgs)
+	case top.ColumnMsgsFrom:
+		if showRates {
+			return top.Nsize(*displayRawBytes, int64(rates.InMsgsRate))
+		}
+		return top.Nsize(*displayRawBytes, conn.InMsgs)
+	case top.ColumnBytesTo:
+		if showRates {
+			return top.Psize(*displayRawBytes, int64(rates.OutBytesRate))
+		}
+		return top.Psize(*displayRawBytes, conn.OutBytes)
+	case top.ColumnBytesFrom:
+		if showRates {
+			return top.Psize(*displayRawBytes, int64(rates.InBytesRate))
+		}
+		return top.Psize(*displayRawBytes, conn.InBytes)
+	case top.ColumnRTT:
+		return top.FormatRTT(conn.RTT)
+	case top.ColumnTLS:
+		return conn.TLSVersion
+	case top.ColumnLang:
+		return conn.Lang
+	case top.ColumnVersion:
+		return conn.Version
+	case top.ColumnUptime:
+		return conn.Uptime
+	case top.ColumnLast:
+		return fmt.Sprint(conn.LastActivity)
+	}
+	return ""
+}
 
-	if nameSize > 0 { // NAME
-		header = append(header, "NAME")
-		connHeader += "%-" + fmt.Sprintf("%d", nameSize) + "s "
+// connHost returns the address of a connection or, when DNS lookup is
+// enabled, the host name of its IP once it was looked up in the background,
+// waited for only when writing the output file.
+func connHost(conn *server.ConnInfo) string {
+	addr := fmt.Sprintf("%s:%d", conn.IP, conn.Port)
+	if !*lookupDNS {
+		return addr
 	}
 
-	header = append(header, standardHeaders...)
+	lookup := resolver.Lookup
+	if *outputFile != "" {
+		lookup = resolver.Resolve
+	}
+	if hostname, ok := lookup(conn.IP); ok {
+		return hostname
+	}
+	return addr
+}
 
-	connHeader += strings.Join(defaultHeaderColumns, "  ")
-	if displaySubs {
-		connHeader += "%13s"
+// displayOrder returns the column the connections are displayed ordered by
+// and whether descending, either as ordered by nats-top or sorted by the server.
+func displayOrder(engine *top.Engine) (top.Column, bool) {
+	if orderBy != top.ColumnNone {
+		return orderBy, orderDir.IsDescending(orderBy.Descending())
 	}
+	return top.SortOrder(engine.Sort())
+}
 
-	connHeader += "\n" // ...LAST ACTIVITY
+// generateTrends returns sparkline charts of the server throughput and load
+// kept in the history, or an empty string if there is not enough of it.
+func generateTrends(history *top.History) string {
+	if !showTrends || history.Len() < 2 {
+		return ""
+	}
 
-	var connRows string
-	if displaySubs {
-		header = append(header, "SUBSCRIPTIONS")
+	spark := func(metric top.Metric) string {
+		var values []float64
+		for _, p := range history.Series(metric) {
+			values = append(values, p.Value)
+		}
+		return fmt.Sprintf("%-*s", sparklineWidth, top.Sparkline(values, sparklineWidth))
 	}
 
-	connRows = fmt.Sprintf(connHeader, header...)
+	snapshots := history.Snapshots()
+	span := snapshots[len(snapshots)-1].Varz.Now.Sub(snapshots[0].Varz.Now).Round(time.Second)
+
+	trends := "Trends (last %s):\n"
+	trends += "  CPU:           %s  Memory:         %s\n"
+	trends += "  In  Msgs/Sec:  %s  In  Bytes/Sec:  %s\n"
+	trends += "  Out Msgs/Sec:  %s  Out Bytes/Sec:  %s"
+
+	return fmt.Sprintf(
+		trends, span,
+		spark(top.MetricCPU), spark(top.MetricMem),
+		spark(top.MetricInMsgsRate), spark(top.MetricInBytesRate),
+		spark(top.MetricOutMsgsRate), spark(top.MetricOutBytesRate),
+	)
+}
 
-	text += connRows // Add to screen!
+// generateConnDetail returns the detail of a connection with charts of
+// its rates kept in the history, and the table of its subscriptions.
+func generateConnDetail(engine *top.Engine, history *top.History, stats *top.Stats, detail *top.ConnDetail) (string, *connsTable) {
+	text := fmt.Sprintf("Connection %d", detail.Cid)
+	if detail.Error != nil {
+		text += fmt.Sprintf("  (%s)", detail.Error)
+	} else if detail.Conn == nil {
+		text += "  (loading...)"
+	}
+	text += "\n"
 
-	connValues := DEFAULT_PADDING
+	conn := detail.Conn
+	if conn == nil {
+		return text, &connsTable{}
+	}
 
-	connValues += "%-" + fmt.Sprintf("%d", hostSize) + "s " // HOST: e.g. 192.168.1.1:78901
+	tls := "-"
+	if conn.TLSVersion != "" {
+		tls = fmt.Sprintf("%s %s", conn.TLSVersion, conn.TLSCipher)
+		if conn.TLSFirst {
+			tls += " (TLS first)"
+		}
+	}
 
-	connValues += " %-6d " // CID: e.g. 1234
+	// The global account is only known by its name tag
+	account := conn.Account
+	if account == "" {
+		account = conn.NameTag
+	} else if conn.NameTag != "" && conn.NameTag != account {
+		account += fmt.Sprintf(" (%s)", conn.NameTag)
+	}
 
-	if nameSize > 0 { // NAME: e.g. hello
-		connValues += "%-" + fmt.Sprintf("%d", nameSize) + "s "
+	info := "  Name:     %s\n"
+	info += "  Kind:     %s %s  Lang: %s %s\n"
+	info += "  Address:  %s:%d  RTT: %s\n"
+	info += "  Account:  %s  User: %s\n"
+	info += "  TLS:      %s\n"
+	info += "  Tags:     %s\n"
+	info += "  Start:    %s  (uptime: %s)\n"
+	info += "  Last:     %s  (idle: %s)\n"
+	text += fmt.Sprintf(info,
+		orNone(conn.Name),
+		conn.Kind, conn.Type, orNone(conn.Lang), conn.Version,
+		conn.IP, conn.Port, orNone(top.FormatRTT(conn.RTT)),
+		orNone(account), orNone(conn.AuthorizedUser),
+		tls,
+		orNone(strings.Join(conn.Tags, ", ")),
+		conn.Start.Format(time.DateTime), conn.Uptime,
+		conn.LastActivity.Format(time.DateTime), conn.Idle,
+	)
+	if conn.IssuerKey != "" {
+		text += fmt.Sprintf("  Issuer:   %s\n", conn.IssuerKey)
+	}
+	if conn.Stop != nil {
+		text += fmt.Sprintf("  Closed:   %s  (%s)\n", conn.Stop.Format(time.DateTime), conn.Reason)
 	}
 
-	connValues += strings.Join(defaultRowColumns, "  ")
-	if displaySubs {
-		connValues += "%s"
+	var crate top.ConnRates
+	if cr := stats.Rates.Connections[conn.Cid]; cr != nil {
+		crate = cr.Windowed(rateWindow)
 	}
-	connValues += "\n"
 
-	for _, conn := range stats.Connz.Conns {
-		var h string
-		if *lookupDNS {
-			if rh, present := resolvedHosts[conn.IP]; present {
-				h = rh
+	traffic := "  Pending:  %s  Stalls: %d\n"
+	traffic += "  In:       Msgs: %s  Bytes: %s  Msgs/Sec: %.1f  Bytes/Sec: %s\n"
+	traffic += "  Out:      Msgs: %s  Bytes: %s  Msgs/Sec: %.1f  Bytes/Sec: %s\n"
+	text += fmt.Sprintf(traffic,
+		top.Psize(*displayRawBytes, int64(conn.Pending)), conn.Stalls,
+		top.Nsize(*displayRawBytes, conn.InMsgs), top.Psize(*displayRawBytes, conn.InBytes),
+		crate.InMsgsRate, top.Psize(*displayRawBytes, int64(crate.InBytesRate)),
+		top.Nsize(*displayRawBytes, conn.OutMsgs), top.Psize(*displayRawBytes, conn.OutBytes),
+		crate.OutMsgsRate, top.Psize(*displayRawBytes, int64(crate.OutBytesRate)),
+	)
+
+	// The rates are only known for the polled connections
+	if series := history.ConnSeries(conn.Cid, top.ConnMetricInMsgsRate); len(series) > 1 {
+		spark := func(metric top.ConnMetric) string {
+			var values []float64
+			for _, p := range history.ConnSeries(conn.Cid, metric) {
+				values = append(values, p.Value)
 			}
-		} else {
-			h = fmt.Sprintf("%s:%d", conn.IP, conn.Port)
+			return fmt.Sprintf("%-*s", sparklineWidth, top.Sparkline(values, sparklineWidth))
 		}
+		span := series[len(series)-1].Time.Sub(series[0].Time).Round(time.Second)
+
+		trends := "\nRates (last %s):\n"
+		trends += "  In  Msgs/Sec:  %s  In  Bytes/Sec:  %s\n"
+		trends += "  Out Msgs/Sec:  %s  Out Bytes/Sec:  %s\n"
+		trends += "  Pending:       %s\n"
+		text += fmt.Sprintf(trends, span,
+			spark(top.ConnMetricInMsgsRate), spark(top.ConnMetricInBytesRate),
+			spark(top.ConnMetricOutMsgsRate), spark(top.ConnMetricOutBytesRate),
+			spark(top.ConnMetricPending),
+		)
+	}
 
-		var connLine string // Build the info line
-		connLineInfo := make([]interface{}, 0)
-		connLineInfo = append(connLineInfo, h)
-		connLineInfo = append(connLineInfo, conn.Cid)
+	text += fmt.Sprintf("\nSubscriptions: %d\n", conn.NumSubs)
 
-		if nameSize > 0 { // Name not included unless present
-			connLineInfo = append(connLineInfo, conn.Name)
+	subjectSize := len("SUBJECT")
+	queueSize := len("QUEUE")
+	for _, sub := range conn.SubsDetail {
+		subjectSize = max(subjectSize, len(sub.Subject))
+		queueSize = max(queueSize, len(sub.Queue))
+	}
+	subs := slices.Clone(conn.SubsDetail)
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Subject < subs[j].Subject })
+
+	row := DEFAULT_PADDING + fmt.Sprintf("%%-%ds  %%-%ds  %%-8s  %%-10s  %%s\n", subjectSize, queueSize)
+
+	table := &connsTable{header: fmt.Sprintf(row, "SUBJECT", "QUEUE", "SID", "MSGS", "MAX")}
+	for _, sub := range subs {
+		var maxMsgs string
+		if sub.Max > 0 {
+			maxMsgs = top.Nsize(*displayRawBytes, sub.Max)
 		}
+		table.rows = append(table.rows, fmt.Sprintf(row, sub.Subject, sub.Queue, sub.Sid, top.Nsize(*displayRawBytes, sub.Msgs), maxMsgs))
+	}
 
-		connLineInfo = append(connLineInfo, conn.NumSubs)
+	return text, table
+}
 
-		connLineInfo = append(connLineInfo, top.Nsize(*displayRawBytes, int64(conn.Pending)))
+// generateChurn returns the number of connections that came and went in
+// the last interval, followed by the most recent ones if there are any.
+func generateChurn(churn *top.Churn) string {
+	text := fmt.Sprintf("  Churn: +%d -%d (%.1f/sec)", churn.New, churn.Gone, churn.Rate)
+	if churn.Partial {
+		text += " (sampled)"
+	}
 
-		if !engine.ShowRates {
-			connLineInfo = append(connLineInfo, top.Nsize(*displayRawBytes, conn.OutMsgs), top.Nsize(*displayRawBytes, conn.InMsgs))
-			connLineInfo = append(connLineInfo, top.Psize(*displayRawBytes, conn.OutBytes), top.Psize(*displayRawBytes, conn.InBytes))
-		} else {
-			var (
-				inMsgsPerSec   float64
-				outMsgsPerSec  float64
-				inBytesPerSec  float64
-				outBytesPerSec float64
-			)
-			crate, wasConnected := stats.Rates.Connections[conn.Cid]
-			if wasConnected {
-				outMsgsPerSec = crate.OutMsgsRate
-				inMsgsPerSec = crate.InMsgsRate
-				outBytesPerSec = crate.OutBytesRate
-				inBytesPerSec = crate.InBytesRate
-			}
-			connLineInfo = append(connLineInfo, top.Nsize(*displayRawBytes, int64(outMsgsPerSec)), top.Nsize(*displayRawBytes, int64(inMsgsPerSec)))
-			connLineInfo = append(connLineInfo, top.Psize(*displayRawBytes, int64(outBytesPerSec)), top.Psize(*displayRawBytes, int64(inBytesPerSec)))
-		}
-
-		connLineInfo = append(connLineInfo, conn.Lang, conn.Version)
-		connLineInfo = append(connLineInfo, conn.Uptime, conn.LastActivity)
+	events := func(label string, events []top.ConnEvent) string {
+		if len(events) == 0 {
+			return ""
+		}
+		line := "\n  " + label
+		for i, e := range events {
+			if i > 0 {
+				line += ", "
+			}
+			if e.Name != "" {
+				line += e.Name + " "
+			}
+			line += fmt.Sprintf("%s:%d (cid %d) at %s", e.IP, e.Port, e.Cid, e.Time.Local().Format(time.TimeOnly))
+		}
+		return line
+	}
+	text += events("Connected:     ", churn.Connected)
+	text += events("Disconnected:  ", churn.Disconnected)
 
-		if displaySubs {
-			subs := strings.Join(conn.Subs, ", ")
-			connLineInfo = append(connLineInfo, subs)
+	return text
+}
+
+// generatePendingWarnings returns the connections whose pending bytes keep
+// growing, soonest to reach the max_pending of the server first, listing
+// at most MAX_PENDING_WARNINGS of them.
+func generatePendingWarnings(stats *top.Stats) string {
+	var conns []*server.ConnInfo
+	for _, conn := range stats.Connz.Conns {
+		if crate := stats.Rates.Connections[conn.Cid]; crate != nil && crate.Pending.Warning() {
+			conns = append(conns, conn)
+		}
+	}
+	if len(conns) == 0 {
+		return ""
+	}
+	sort.SliceStable(conns, func(i, j int) bool {
+		return stats.Rates.Connections[conns[i].Cid].Pending.TimeToMax < stats.Rates.Connections[conns[j].Cid].Pending.TimeToMax
+	})
+
+	text := fmt.Sprintf("%c Pending growing (max_pending: %s):\n", PENDING_WARNING_MARKER, top.Psize(*displayRawBytes, stats.Varz.MaxPending))
+	for _, conn := range conns[:min(len(conns), MAX_PENDING_WARNINGS)] {
+		trend := stats.Rates.Connections[conn.Cid].Pending
+		text += fmt.Sprintf("%c   cid %d", PENDING_WARNING_MARKER, conn.Cid)
+		if conn.Name != "" {
+			text += " " + conn.Name
 		}
+		text += fmt.Sprintf("  pending: %s  growth: %s/sec", top.Psize(*displayRawBytes, int64(conn.Pending)), top.Psize(*displayRawBytes, int64(trend.Rate)))
+		if trend.TimeToMax > 0 {
+			text += fmt.Sprintf("  slow consumer in ~%s", trend.TimeToMax.Round(time.Second))
+		} else if stats.Varz.MaxPending > 0 {
+			text += "  at max_pending"
+		}
+		text += "\n"
+	}
+	if more := len(conns) - MAX_PENDING_WARNINGS; more > 0 {
+		text += fmt.Sprintf("%c   +%d more\n", PENDING_WARNING_MARKER, more)
+	}
 
-		connLine = fmt.Sprintf(connValues, connLineInfo...)
+	return text
+}
 
-		text += connLine // Add line to screen!
+// generateDistribution returns how pending bytes, msgs per second and
+// subscriptions are spread across the polled connections.
+func generateDistribution(stats *top.Stats) string {
+	dist := top.NewConnsDistribution(stats)
+
+	row := func(label string, d top.Distribution, size func(bool, int64) string) string {
+		return fmt.Sprintf("  %-20s%-10s%-10s%-10s%-10s%s\n", label,
+			size(*displayRawBytes, int64(d.Min)),
+			size(*displayRawBytes, int64(d.Median)),
+			size(*displayRawBytes, int64(d.P90)),
+			size(*displayRawBytes, int64(d.P99)),
+			size(*displayRawBytes, int64(d.Max)))
 	}
 
+	text := fmt.Sprintf("  %-20s%-10s%-10s%-10s%-10s%s\n", "", "MIN", "MEDIAN", "P90", "P99", "MAX")
+	text += row("Pending:", dist.Pending, top.Psize)
+	text += row("Msgs/Sec (in+out):", dist.MsgsRate, top.Nsize)
+	text += row("Subs:", dist.NumSubs, top.Nsize)
+	text += "\n"
+
 	return text
 }
 
+// generateGroups returns the connections aggregated by the group by field,
+// as a table padded with spaces or with columns separated by delimiter.
+func generateGroups(stats *top.Stats, delimiter string) *connsTable {
+	groups := top.GroupConns(stats, groupBy, rateWindow)
+
+	keySize := len(groupBy) + DEFAULT_PADDING_SIZE
+	for _, g := range groups {
+		if size := len(g.Key) + DEFAULT_PADDING_SIZE; size > keySize {
+			keySize = size
+		}
+	}
+
+	columns := []string{"%-" + fmt.Sprintf("%d", keySize) + "s", "%-6s", "%-6s", "%-10s", "%-10s", "%-10s", "%-10s", "%-10s", "%-12s", "%-12s", "%-12s", "%-12s"}
+	format := DEFAULT_PADDING + strings.Join(columns, "  ") + "\n"
+	if delimiter != "" {
+		format = strings.Repeat("%s"+delimiter, len(columns)-1) + "%s\n"
+	}
+
+	table := &connsTable{}
+	table.header = fmt.Sprintf(format, strings.ToUpper(string(groupBy)), "CONNS", "SUBS", "PENDING",
+		"MSGS_TO", "MSGS_FROM", "BYTES_TO", "BYTES_FROM",
+		"MSGS_TO/S", "MSGS_FROM/S", "BYTES_TO/S", "BYTES_FROM/S")
+
+	for _, g := range groups {
+		key := g.Key
+		if key == "" {
+			key = "-"
+		}
+		table.rows = append(table.rows, fmt.Sprintf(format, key, fmt.Sprintf("%d", g.Conns), fmt.Sprintf("%d", g.NumSubs),
+			top.Psize(*displayRawBytes, int64(g.Pending)),
+			top.Nsize(*displayRawBytes, g.OutMsgs), top.Nsize(*displayRawBytes, g.InMsgs),
+			top.Psize(*displayRawBytes, g.OutBytes), top.Psize(*displayRawBytes, g.InBytes),
+			top.Nsize(*displayRawBytes, int64(g.Rates.OutMsgsRate)), top.Nsize(*displayRawBytes, int64(g.Rates.InMsgsRate)),
+			top.Psize(*displayRawBytes, int64(g.Rates.OutBytesRate)), top.Psize(*displayRawBytes, int64(g.Rates.InBytesRate))))
+	}
+
+	return table
+}
+
 func generateParagraphCSV(
 	engine *top.Engine,
 	stats *top.Stats,
 	delimiter string,
 ) string {
 
-	defaultHeaderAndRowColumnsForCsv := []string{"%s", "%s", "%s", "%s", "%s", "%s", "%s", "%s", "%s", "%s"} // Chopped: HOST CID NAME...
-
 	cpu := stats.Varz.CPU // Snapshot current stats
 	memVal := stats.Varz.Mem
 	uptime := stats.Varz.Uptime
@@ -444,92 +1047,36 @@ func generateParagraphCSV(
 
 	text += fmt.Sprintf("\n\nConnections Polled:[__DELIM__]%d\n", numConns)
 
-	displaySubs := engine.DisplaySubs
-	for _, conn := range stats.Connz.Conns {
-		if !*lookupDNS {
-			continue
-		}
-
-		_, present := resolvedHosts[conn.IP]
-		if present {
-			continue
-		}
-
-		addrs, err := net.LookupAddr(conn.IP)
-
-		hostname := ""
-		if err == nil && len(addrs) > 0 && len(addrs[0]) > 0 { // Make a lookup for each one of the ips and memoize them for subsequent polls
-			hostname = addrs[0]
-		} else { // Otherwise just continue to use ip:port as resolved host can be an empty string even though there were no errors
-			hostname = fmt.Sprintf("%s:%d", conn.IP, conn.Port)
-		}
-
-		resolvedHosts[conn.IP] = hostname
+	if groupBy != top.GroupByNone {
+		text += generateGroups(stats, "[__DELIM__]").String()
+		return strings.ReplaceAll(text, "[__DELIM__]", delimiter)
 	}
 
-	header := make([]interface{}, 0) // Dynamically add columns
-	connHeader := ""
-
-	header = append(header, "HOST") // HOST
-	connHeader += "%s[__DELIM__]"
-
-	header = append(header, "CID") // CID
-	connHeader += "%s[__DELIM__]"
-
-	header = append(header, "NAME") // NAME
-	connHeader += "%s[__DELIM__]"
-
-	header = append(header, standardHeaders...)
-	connHeader += strings.Join(defaultHeaderAndRowColumnsForCsv, "[__DELIM__]")
+	displaySubs := engine.DisplaySubs
+	conns := top.OrderConns(stats, orderBy, orderDir.IsDescending(orderBy.Descending()), engine.ShowRates, rateWindow)
 
-	if displaySubs {
-		connHeader += "[__DELIM__]%s" // SUBSCRIPTIONS
+	header := make([]string, 0, len(displayColumns)+1) // Dynamically add columns
+	for _, column := range displayColumns {
+		header = append(header, columnHeaders[column])
 	}
-
-	connHeader += "\n" // ...LAST ACTIVITY
-
 	if displaySubs {
 		header = append(header, "SUBSCRIPTIONS")
 	}
+	text += strings.Join(header, "[__DELIM__]") + "\n" // Add to screen!
 
-	text += fmt.Sprintf(connHeader, header...) // Add to screen!
-
-	connValues := "%s[__DELIM__]" // HOST: e.g. 192.168.1.1:78901
-	connValues += "%d[__DELIM__]" // CID: e.g. 1234
-	connValues += "%s[__DELIM__]" // NAME: e.g. hello
-
-	connValues += strings.Join(defaultHeaderAndRowColumnsForCsv, "[__DELIM__]")
-	if displaySubs {
-		connValues += "%s"
-	}
-	connValues += "\n"
-
-	for _, conn := range stats.Connz.Conns {
-		var h string
-		if *lookupDNS {
-			if rh, present := resolvedHosts[conn.IP]; present {
-				h = rh
-			}
-		} else {
-			h = fmt.Sprintf("%s:%d", conn.IP, conn.Port)
+	for _, conn := range conns {
+		connLineInfo := make([]string, 0, len(header))
+		for _, column := range displayColumns {
+			// The snapshot is of the totals, there are no rates yet
+			connLineInfo = append(connLineInfo, connValue(stats, conn, column, false))
 		}
 
-		connLineInfo := make([]interface{}, 0)
-		connLineInfo = append(connLineInfo, h)
-		connLineInfo = append(connLineInfo, conn.Cid)
-		connLineInfo = append(connLineInfo, conn.Name)
-		connLineInfo = append(connLineInfo, fmt.Sprintf("%d", conn.NumSubs))
-		connLineInfo = append(connLineInfo, top.Nsize(*displayRawBytes, int64(conn.Pending)), top.Nsize(*displayRawBytes, conn.OutMsgs), top.Nsize(*displayRawBytes, conn.InMsgs))
-		connLineInfo = append(connLineInfo, top.Psize(*displayRawBytes, conn.OutBytes), top.Psize(*displayRawBytes, conn.InBytes))
-		connLineInfo = append(connLineInfo, conn.Lang, conn.Version)
-		connLineInfo = append(connLineInfo, conn.Uptime, conn.LastActivity)
-
 		if displaySubs {
-			subs := "[__DELIM__]" + strings.Join(conn.Subs, "  ") // its safer to use a couple of whitespaces instead of commas to separate the subs because comma is reserved to separate entire columns!
+			subs := strings.Join(conn.Subs, "  ") // its safer to use a couple of whitespaces instead of commas to separate the subs because comma is reserved to separate entire columns!
 			connLineInfo = append(connLineInfo, subs)
 		}
 
-		text += fmt.Sprintf(connValues, connLineInfo...)
+		text += strings.Join(connLineInfo, "[__DELIM__]") + "\n"
 	}
 
 	text = strings.ReplaceAll(text, "[__DELIM__]", delimiter)
@@ -542,17 +1089,72 @@ type ViewMode int
 const (
 	TopViewMode ViewMode = iota
 	HelpViewMode
+	DetailViewMode
+	ColumnsViewMode
 )
 
-type RedrawCause int
+// lineHighlights are the styles of the lines starting with a marker,
+// e.g. connections at risk of becoming slow consumers.
+var lineHighlights = map[rune]ui.Style{
+	PENDING_WARNING_MARKER: {Fg: ui.ColorRed, Bold: true},
+	HIGH_RTT_MARKER:        {Fg: ui.ColorYellow},
+}
 
-const (
-	DueToNewStats RedrawCause = iota
-	DueToViewportResize
-)
+// levelStyles are the styles of the values past their thresholds.
+var levelStyles = map[top.Level]ui.Style{
+	top.LevelWarning:  {Fg: ui.ColorYellow, Bold: true},
+	top.LevelCritical: {Fg: ui.ColorRed, Bold: true},
+}
+
+// highlightLoad highlights the CPU and memory of the server in the header
+// of the top view when they are past their thresholds.
+func highlightLoad(lines []ui.Line, stats *top.Stats) {
+	for i, line := range lines {
+		if !strings.HasPrefix(line.Text, "  Load: ") {
+			continue
+		}
+		for _, load := range []struct {
+			label  string
+			value  string
+			metric top.ThresholdMetric
+			v      float64
+		}{
+			{"CPU:  ", fmt.Sprintf("%.1f%%", stats.Varz.CPU), top.ThresholdCPU, stats.Varz.CPU},
+			{"Memory: ", top.Psize(false, stats.Varz.Mem), top.ThresholdMem, float64(stats.Varz.Mem)},
+		} {
+			level := thresholds[load.metric].Level(load.v)
+			// The load line is all ASCII, so bytes are runes
+			start := strings.Index(line.Text, load.label+load.value)
+			if level == top.LevelNormal || start < 0 {
+				continue
+			}
+			start += len(load.label)
+			lines[i].Spans = append(lines[i].Spans, ui.Span{Start: start, End: start + len(load.value), Style: levelStyles[level]})
+		}
+		return
+	}
+}
+
+// topViewLines returns the lines of the top view, greyed out when
+// the stats are stale and otherwise highlighted by their markers.
+func topViewLines(text string, stale bool) []ui.Line {
+	if stale {
+		return ui.Lines(text, ui.Style{Fg: ui.ColorGray, Bold: true})
+	}
+
+	lines := ui.Lines(text, ui.Style{})
+	for i, line := range lines {
+		for marker, style := range lineHighlights {
+			if strings.HasPrefix(line.Text, string(marker)) {
+				lines[i].Style = style
+			}
+		}
+	}
+	return lines
+}
 
 // StartUI periodically refreshes the screen using recent data.
-func StartUI(engine *top.Engine) {
+func StartUI(engine *top.Engine, renderer ui.Renderer) {
 
 	cleanStats := &top.Stats{
 		Varz:  &server.Varz{},
@@ -561,109 +1163,256 @@ func StartUI(engine *top.Engine) {
 		Error: fmt.Errorf(""),
 	}
 
-	// Show empty values on first display
-	text := generateParagraph(engine, cleanStats, "")
-	par := ui.NewPar(text)
-	par.Height = ui.TermHeight()
-	par.Width = ui.TermWidth()
-	par.HasBorder = false
-
-	helpText := generateHelp()
-	helpPar := ui.NewPar(helpText)
-	helpPar.Height = ui.TermHeight()
-	helpPar.Width = ui.TermWidth()
-	helpPar.HasBorder = false
+	width, _ := renderer.Size()
+	resizeSparklines(width)
 
-	// Top like view
-	paraRow := ui.NewRow(ui.NewCol(ui.TermWidth(), 0, par))
+	// Show empty values on first display
+	text, table := generateTopView(engine, engine.History, cleanStats)
+	stale := false
+
+	// The connections table scrolls below the header, keeping the
+	// cursor on the selected connection as they change between polls.
+	tableView := &ui.Table{}
+	var selectedCid uint64
+	updateTable := func() {
+		tableView.Header = topViewLines(table.header, stale)[0]
+		tableView.Rows = topViewLines(strings.Join(table.rows, ""), stale)
+		for i := range tableView.Rows {
+			// Rows with critical values stand out as a whole
+			if stale || i >= len(table.spans) {
+				break
+			}
+			tableView.Rows[i].Spans = table.spans[i]
+			if table.levels[i] == top.LevelCritical {
+				tableView.Rows[i].Style = levelStyles[top.LevelCritical]
+			}
+		}
+		if i := slices.Index(table.cids, selectedCid); i >= 0 {
+			tableView.Cursor = i
+		}
+	}
+	updateTable()
+
+	// The detail of the connection opened from the table, refreshed
+	// on every poll, with its own table of subscriptions.
+	lastStats := cleanStats
+	var detail *top.ConnDetail
+	detailTable := &ui.Table{}
+	closeDetail := func() {
+		engine.FollowConn(0)
+		detail = nil
+	}
 
-	// Help view
-	helpParaRow := ui.NewRow(ui.NewCol(ui.TermWidth(), 0, helpPar))
+	// While paused the display is frozen on the last stats and the
+	// history as it was then, and pause holds the latest stats of each tab.
+	var pause *top.Pause
+	history := func() *top.History {
+		if pause != nil {
+			return pause.History()
+		}
+		return engine.History
+	}
 
-	// Create grids that we'll be using to toggle what to render
-	topViewGrid := ui.NewGrid(paraRow)
-	helpViewGrid := ui.NewGrid(helpParaRow)
+	// All the columns of the connections table in the column chooser,
+	// the displayed ones first, in the order they are displayed.
+	chooserColumns := []top.Column{}
+	chooserTable := &ui.Table{}
+	refresh := func() {
+		text, table = generateTopView(engine, history(), lastStats)
+		updateTable()
+	}
 
-	// Start with the topviewGrid by default
-	ui.Body.Rows = topViewGrid.Rows
-	ui.Body.Align()
+	help := &ui.Text{Lines: ui.Lines(generateHelp(), ui.Style{})}
 
 	// Used to toggle back to previous mode
 	viewMode := TopViewMode
 
-	// Used for pinging the IU to refresh the screen with new values
-	redraw := make(chan RedrawCause)
+	// The tab displayed in the top view, and the last stats and
+	// the table of each one of the others.
+	tab := top.TabConnections
+	tabStats := map[top.Tab]*top.Stats{}
+	tabTables := map[top.Tab]*ui.Table{}
+
+	// Prompt for options drawn over the header, and when to clear it if
+	// it is only a message.
+	prompt := ""
+	var promptTimeout <-chan time.Time
+
+	view := func() *ui.View {
+		view := &ui.View{Prompt: prompt}
+		if viewMode == HelpViewMode {
+			view.Lines = help.Shown()
+		} else if viewMode == ColumnsViewMode {
+			view.Lines = ui.Lines(columnsHelp, ui.Style{})
+			view.Lines = append(view.Lines, ui.Line{Text: strings.TrimSuffix(table.header, "\n"), Style: ui.Style{Bold: true}}, ui.Line{})
+			chooserTable.Header = ui.Line{Text: "  SHOWN  COLUMN"}
+			chooserTable.Rows = chooserTable.Rows[:0]
+			for _, column := range chooserColumns {
+				shown := " "
+				if slices.Contains(displayColumns, column) {
+					shown = "x"
+				}
+				chooserTable.Rows = append(chooserTable.Rows, ui.Line{Text: fmt.Sprintf("  [%s]    %s", shown, columnHeaders[column])})
+			}
+			view.Table = chooserTable
+		} else if viewMode == DetailViewMode {
+			text, table := generateConnDetail(engine, history(), lastStats, detail)
+			view.Lines = topViewLines(text, stale)
+			if detail.Conn != nil {
+				detailTable.Header = ui.Line{Text: strings.TrimSuffix(table.header, "\n")}
+				detailTable.Rows = ui.Lines(strings.Join(table.rows, ""), ui.Style{})
+				view.Table = detailTable
+			}
+		} else if tab != top.TabConnections {
+			stats := tabStats[tab]
+			tabStale := stats != nil && stats.Stale
+			text, table := generateTab(tab, stats)
+			view.Lines = topViewLines(text, tabStale)
+			if tab == top.TabServer && stats != nil && !tabStale {
+				highlightLoad(view.Lines, stats)
+			}
+			if table.header != "" {
+				if tabTables[tab] == nil {
+					tabTables[tab] = &ui.Table{}
+				}
+				tabTables[tab].Header = topViewLines(table.header, tabStale)[0]
+				tabTables[tab].Rows = topViewLines(strings.Join(table.rows, ""), tabStale)
+				view.Table = tabTables[tab]
+			}
+		} else {
+			view.Lines = topViewLines(text, stale)
+			if !stale {
+				highlightLoad(view.Lines, lastStats)
+			}
+			view.Table = tableView
+		}
+		if viewMode == TopViewMode {
+			view.Lines = append([]ui.Line{generateTabBar(tab, engine.Interval())}, view.Lines...)
+		}
+		if pause != nil && len(view.Lines) > 0 {
+			polled := lastStats
+			if viewMode == TopViewMode && tab != top.TabConnections && tabStats[tab] != nil {
+				polled = tabStats[tab]
+			}
+			marker := fmt.Sprintf("PAUSED at %s", polledAt(polled).Format(time.TimeOnly))
+			line := &view.Lines[0]
+			line.Text += "  "
+			start := utf8.RuneCountInString(line.Text)
+			line.Text += marker
+			line.Spans = append(line.Spans, ui.Span{Start: start, End: start + len(marker), Style: ui.Style{Bold: true, Reverse: true}})
+		}
+		if prompt != "" {
+			view.PromptRow = promptRow(view)
+		}
+		return view
+	}
+	draw := func() {
+		renderer.Draw(view())
+	}
 
-	update := func() {
-		for {
-			stats := <-engine.StatsCh
+	update := func(stats *top.Stats) {
+		// The stats of the other tabs are only displayed as they are
+		if stats.Tab != top.TabConnections {
+			tabStats[stats.Tab] = stats
+			return
+		}
+
+		text, table = generateTopView(engine, history(), stats) // Update top view text
 
-			par.Text = generateParagraph(engine, stats, "") // Update top view text
+		// Grey out the last good snapshot while disconnected
+		stale = stats.Stale
+		updateTable()
 
-			redraw <- DueToNewStats
+		lastStats = stats
+		if detail != nil && stats.Detail != nil && stats.Detail.Cid == detail.Cid {
+			detail = stats.Detail
 		}
 	}
 
 	// Flags for capturing options
 	waitingSortOption := false
 	waitingLimitOption := false
+	waitingOrderOption := false
+	waitingFilterOption := false
+	waitingIntervalOption := false
 
 	optionBuf := ""
-	refreshOptionHeader := func() {
-		clrline := fmt.Sprintf("%s                  ", UI_HEADER_PREFIX) // Need to mask what was typed before
-
-		clrline += "  "
-		for i := 0; i < len(optionBuf); i++ {
-			clrline += "  "
-		}
-		fmt.Print(clrline)
-	}
-
-	evt := ui.EventCh()
 
-	ui.Render(ui.Body)
+	evt := renderer.Events()
 
-	go update()
+	draw()
 
 	numberOfRedrawsDueToNewStats := 0
 	for {
 		select {
-		case e := <-evt:
+		case stats := <-engine.StatsCh:
+			// The engine keeps polling while paused, and the
+			// latest stats are displayed once resumed.
+			if pause != nil {
+				pause.Hold(stats)
+				// Unless it is the detail just opened, not polled before
+				if detail != nil && detail.Conn == nil && detail.Error == nil && stats.Detail != nil && stats.Detail.Cid == detail.Cid {
+					detail = stats.Detail
+					draw()
+				}
+				break
+			}
+			update(stats)
+			draw()
+
+			numberOfRedrawsDueToNewStats += 1
+
+			if *maxStatsRefreshes > 0 && numberOfRedrawsDueToNewStats >= *maxStatsRefreshes {
+				close(engine.ShutdownCh)
+				cleanExit(renderer)
+			}
+
+		case <-resolver.Resolved:
+			// The host names looked up since are displayed right away
+			if pause == nil {
+				refresh()
+				draw()
+			}
+
+		case <-promptTimeout:
+			prompt = ""
+			promptTimeout = nil
+			draw()
+
+		case e, ok := <-evt:
+			if !ok {
+				close(engine.ShutdownCh)
+				cleanExit(renderer)
+			}
 
 			if waitingSortOption {
 
 				if e.Type == ui.EventKey && e.Key == ui.KeyEnter {
 
-					sortOpt := server.SortOpt(optionBuf)
+					sortName, sortDirection := top.SplitDirection(optionBuf)
+					sortOpt := server.SortOpt(sortName)
 					if sortOpt.IsValid() {
-						engine.SortOpt = sortOpt
+						engine.SetSort(sortOpt, sortDirection)
+						prompt = ""
 					} else {
-						go func() {
-							// Has to be at least of the same length as sort by header
-							emptyPadding := "       "
-							fmt.Printf("%sinvalid order: %s%s", UI_HEADER_PREFIX, optionBuf, emptyPadding)
-							waitingSortOption = false
-							time.Sleep(1 * time.Second)
-							refreshOptionHeader()
-							optionBuf = ""
-						}()
-						continue
+						prompt = fmt.Sprintf("invalid order: %s", optionBuf)
+						promptTimeout = time.After(1 * time.Second)
 					}
 
-					refreshOptionHeader()
 					waitingSortOption = false
 					optionBuf = ""
+					draw()
 					continue
 				}
 
 				// Handle backspace
-				if e.Type == ui.EventKey && len(optionBuf) > 0 && (e.Key == ui.KeyBackspace || e.Key == ui.KeyBackspace2) {
+				if e.Type == ui.EventKey && len(optionBuf) > 0 && e.Key == ui.KeyBackspace {
 					optionBuf = optionBuf[:len(optionBuf)-1]
-					refreshOptionHeader()
-				} else {
+				} else if e.Type == ui.EventKey && e.Key == ui.KeyRune {
 					optionBuf += string(e.Ch)
 				}
-				fmt.Printf("%ssort by [%s]: %s", UI_HEADER_PREFIX, engine.SortOpt, optionBuf)
+				sortOpt, sortDirection := engine.Sort()
+				prompt = fmt.Sprintf("sort by [%s%s]: %s", sortDirection.Prefix(), sortOpt, optionBuf)
 			}
 
 			if waitingLimitOption {
@@ -678,88 +1427,420 @@ func StartUI(engine *top.Engine) {
 
 					waitingLimitOption = false
 					optionBuf = ""
-					refreshOptionHeader()
+					prompt = ""
+					draw()
 					continue
 				}
 
 				// Handle backspace
-				if e.Type == ui.EventKey && len(optionBuf) > 0 && (e.Key == ui.KeyBackspace || e.Key == ui.KeyBackspace2) {
+				if e.Type == ui.EventKey && len(optionBuf) > 0 && e.Key == ui.KeyBackspace {
 					optionBuf = optionBuf[:len(optionBuf)-1]
-					refreshOptionHeader()
-				} else {
+				} else if e.Type == ui.EventKey && e.Key == ui.KeyRune {
 					optionBuf += string(e.Ch)
 				}
-				fmt.Printf("%slimit   [%d]: %s", UI_HEADER_PREFIX, engine.Conns, optionBuf)
+				prompt = fmt.Sprintf("limit   [%d]: %s", engine.Conns, optionBuf)
 			}
 
-			if e.Type == ui.EventKey && e.Key == ui.KeySpace {
+			if waitingOrderOption {
+
+				if e.Type == ui.EventKey && e.Key == ui.KeyEnter {
+
+					orderName, orderDirection := top.SplitDirection(optionBuf)
+					column := top.Column(orderName)
+					if column.IsValid() {
+						orderBy = column
+						orderDir = orderDirection
+						prompt = ""
+					} else {
+						prompt = fmt.Sprintf("invalid column: %s", optionBuf)
+						promptTimeout = time.After(1 * time.Second)
+					}
+
+					waitingOrderOption = false
+					optionBuf = ""
+					draw()
+					continue
+				}
+
+				// Handle backspace
+				if e.Type == ui.EventKey && len(optionBuf) > 0 && e.Key == ui.KeyBackspace {
+					optionBuf = optionBuf[:len(optionBuf)-1]
+				} else if e.Type == ui.EventKey && e.Key == ui.KeyRune {
+					optionBuf += string(e.Ch)
+				}
+				prompt = fmt.Sprintf("order by [%s%s]: %s", orderDir.Prefix(), orderBy, optionBuf)
+			}
+
+			if waitingFilterOption {
+
+				if e.Type == ui.EventKey && (e.Key == ui.KeyEnter || e.Key == ui.KeyEsc) {
+
+					// An empty filter or esc displays all connections again
+					var filter *top.ConnFilter
+					if e.Key == ui.KeyEnter && optionBuf != "" {
+						filter = top.NewConnFilter(optionBuf)
+					}
+					engine.SetFilter(filter)
+					refresh()
+
+					waitingFilterOption = false
+					optionBuf = ""
+					prompt = ""
+					draw()
+					continue
+				}
+
+				// Handle backspace
+				if e.Type == ui.EventKey && len(optionBuf) > 0 && e.Key == ui.KeyBackspace {
+					optionBuf = optionBuf[:len(optionBuf)-1]
+				} else if e.Type == ui.EventKey && e.Key == ui.KeyRune {
+					optionBuf += string(e.Ch)
+				}
+				prompt = fmt.Sprintf("filter: %s", optionBuf)
+			}
+
+			if waitingIntervalOption {
+
+				if e.Type == ui.EventKey && e.Key == ui.KeyEnter {
+
+					// An empty interval keeps the current one
+					prompt = ""
+					if interval, err := top.ParseInterval(optionBuf); err == nil {
+						engine.SetInterval(interval)
+					} else if optionBuf != "" {
+						prompt = err.Error()
+						promptTimeout = time.After(1 * time.Second)
+					}
+
+					waitingIntervalOption = false
+					optionBuf = ""
+					draw()
+					continue
+				}
+
+				// Handle backspace
+				if e.Type == ui.EventKey && len(optionBuf) > 0 && e.Key == ui.KeyBackspace {
+					optionBuf = optionBuf[:len(optionBuf)-1]
+				} else if e.Type == ui.EventKey && e.Key == ui.KeyRune {
+					optionBuf += string(e.Ch)
+				}
+				prompt = fmt.Sprintf("refresh [%s]: %s", engine.Interval(), optionBuf)
+			}
+
+			if e.Type == ui.EventKey && e.Ch == ' ' && !waitingFilterOption && viewMode != ColumnsViewMode {
 				engine.ShowRates = !engine.ShowRates
 			}
 
-			if e.Type == ui.EventKey && (e.Ch == 'q' || e.Key == ui.KeyCtrlC) {
+			if e.Type == ui.EventKey && ((e.Ch == 'q' && !waitingFilterOption) || e.Key == ui.KeyCtrlC) {
 				close(engine.ShutdownCh)
-				cleanExit()
+				cleanExit(renderer)
 			}
 
-			if e.Type == ui.EventKey && e.Ch == 's' && !(waitingLimitOption || waitingSortOption) {
+			if e.Type == ui.EventKey && e.Ch == 's' && !(waitingLimitOption || waitingSortOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
 				engine.DisplaySubs = !engine.DisplaySubs
 			}
 
+			// The help scrolls with the navigation keys, and any other key closes it
 			if e.Type == ui.EventKey && viewMode == HelpViewMode {
-				ui.Body.Rows = topViewGrid.Rows
-				viewMode = TopViewMode
+				if _, height := renderer.Size(); !help.Move(e.Key, height) {
+					viewMode = TopViewMode
+				}
+				draw()
 				continue
 			}
 
-			if e.Type == ui.EventKey && e.Ch == 'o' && !waitingLimitOption && viewMode == TopViewMode {
-				fmt.Printf("%ssort by [%s]:", UI_HEADER_PREFIX, engine.SortOpt)
+			if e.Type == ui.EventKey && viewMode == ColumnsViewMode {
+				if e.Key == ui.KeyEsc || e.Key == ui.KeyEnter || e.Ch == 'c' {
+					viewMode = TopViewMode
+					draw()
+					continue
+				}
+
+				_, height := renderer.Size()
+				column := chooserColumns[min(chooserTable.Cursor, len(chooserColumns)-1)]
+				columns := displayColumns
+				switch {
+				case e.Ch == ' ':
+					// Keep at least one column displayed
+					if !slices.Contains(columns, column) {
+						columns = append(slices.Clone(columns), column)
+					} else if len(columns) > 1 {
+						columns = slices.DeleteFunc(slices.Clone(columns), func(c top.Column) bool { return c == column })
+					}
+				case e.Key == ui.KeyLeft || e.Key == ui.KeyRight:
+					offset := 1
+					if e.Key == ui.KeyLeft {
+						offset = -1
+					}
+					chooserColumns = top.MoveColumn(chooserColumns, column, offset)
+					chooserTable.Cursor = slices.Index(chooserColumns, column)
+				default:
+					chooserTable.Move(e.Key, view().TableRows(height))
+				}
+
+				// The displayed columns are in the order of the chooser
+				columns = slices.DeleteFunc(slices.Clone(chooserColumns), func(c top.Column) bool { return !slices.Contains(columns, c) })
+				if !slices.Equal(columns, displayColumns) {
+					displayColumns = columns
+					refresh()
+					if err := saveColumns(); err != nil {
+						prompt = fmt.Sprintf("could not save columns: %s", err)
+						promptTimeout = time.After(1 * time.Second)
+					}
+				}
+			}
+
+			if e.Type == ui.EventKey && viewMode == DetailViewMode {
+				if e.Key == ui.KeyEsc || e.Key == ui.KeyEnter {
+					closeDetail()
+					viewMode = TopViewMode
+					draw()
+					continue
+				}
+				_, height := renderer.Size()
+				detailTable.Move(e.Key, view().TableRows(height))
+			}
+
+			if e.Type == ui.EventKey && viewMode == TopViewMode && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
+				_, height := renderer.Size()
+				v := view()
+				if v.Table != nil && v.Table.Move(e.Key, v.TableRows(height)) && tab == top.TabConnections && tableView.Cursor < len(table.cids) {
+					selectedCid = table.cids[tableView.Cursor]
+				}
+			}
+
+			if e.Type == ui.EventKey && e.Ch >= '1' && e.Ch < '1'+rune(len(top.Tabs)) && viewMode == TopViewMode && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
+				tab = top.Tabs[e.Ch-'1']
+				engine.SetTab(tab)
+			}
+
+			if e.Type == ui.EventKey && e.Key == ui.KeyEnter && viewMode == TopViewMode && tab == top.TabConnections && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) && tableView.Cursor < len(table.cids) {
+				selectedCid = table.cids[tableView.Cursor]
+				// The engine polls the detail right away, displayed once it arrives
+				engine.FollowConn(selectedCid)
+				detail = &top.ConnDetail{Cid: selectedCid}
+				detailTable = &ui.Table{}
+				viewMode = DetailViewMode
+			}
+
+			if e.Type == ui.EventKey && e.Ch == 'o' && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) && viewMode == TopViewMode && tab == top.TabConnections {
+				sortOpt, sortDirection := engine.Sort()
+				prompt = fmt.Sprintf("sort by [%s%s]:", sortDirection.Prefix(), sortOpt)
 				waitingSortOption = true
 			}
 
-			if e.Type == ui.EventKey && e.Ch == 'n' && !waitingSortOption && viewMode == TopViewMode {
-				fmt.Printf("%slimit   [%d]:", UI_HEADER_PREFIX, engine.Conns)
+			if e.Type == ui.EventKey && e.Ch == 'O' && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) && viewMode == TopViewMode && tab == top.TabConnections {
+				prompt = fmt.Sprintf("order by [%s%s]:", orderDir.Prefix(), orderBy)
+				waitingOrderOption = true
+			}
+
+			if e.Type == ui.EventKey && e.Ch == '/' && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) && viewMode == TopViewMode && tab == top.TabConnections {
+				prompt = "filter:"
+				if filter := engine.Filter(); filter != nil {
+					optionBuf = filter.Pattern
+					prompt = fmt.Sprintf("filter: %s", optionBuf)
+				}
+				waitingFilterOption = true
+			}
+
+			if e.Type == ui.EventKey && e.Key == ui.KeyEsc && engine.Filter() != nil && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) && viewMode == TopViewMode && tab == top.TabConnections {
+				engine.SetFilter(nil)
+				refresh()
+			}
+
+			if e.Type == ui.EventKey && e.Ch == 'c' && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) && viewMode == TopViewMode && tab == top.TabConnections {
+				chooserColumns = slices.Clone(displayColumns)
+				for _, column := range top.OrderColumns {
+					if !slices.Contains(chooserColumns, column) {
+						chooserColumns = append(chooserColumns, column)
+					}
+				}
+				chooserTable = &ui.Table{}
+				viewMode = ColumnsViewMode
+			}
+
+			if e.Type == ui.EventKey && e.Ch == 'n' && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) && viewMode == TopViewMode && tab == top.TabConnections {
+				prompt = fmt.Sprintf("limit   [%d]:", engine.Conns)
 				waitingLimitOption = true
 			}
 
-			if e.Type == ui.EventKey && (e.Ch == '?' || e.Ch == 'h') && !(waitingSortOption || waitingLimitOption) {
+			if e.Type == ui.EventKey && (e.Ch == '?' || e.Ch == 'h') && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
 				if viewMode == TopViewMode {
-					refreshOptionHeader()
+					prompt = ""
 					optionBuf = ""
 				}
+				if viewMode == DetailViewMode {
+					closeDetail()
+				}
 
-				ui.Body.Rows = helpViewGrid.Rows
 				viewMode = HelpViewMode
+				help.Offset = 0
 				waitingLimitOption = false
 				waitingSortOption = false
+				waitingOrderOption = false
+				waitingFilterOption = false
+				waitingIntervalOption = false
+			}
+
+			if e.Type == ui.EventKey && e.Ch == 'r' && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) && viewMode == TopViewMode {
+				prompt = fmt.Sprintf("refresh [%s]:", engine.Interval())
+				waitingIntervalOption = true
 			}
 
-			if e.Type == ui.EventKey && (e.Ch == 'd') && !(waitingSortOption || waitingLimitOption) {
+			if e.Type == ui.EventKey && (e.Ch == 'd') && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
 				*lookupDNS = !*lookupDNS
 			}
 
-			if e.Type == ui.EventKey && (e.Ch == 'b') && !(waitingSortOption || waitingLimitOption) {
+			if e.Type == ui.EventKey && (e.Ch == 'b') && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
 				*displayRawBytes = !*displayRawBytes
 			}
 
-			if e.Type == ui.EventResize {
-				ui.Body.Width = ui.TermWidth()
-				ui.Body.Align()
-				go func() { redraw <- DueToViewportResize }()
+			if e.Type == ui.EventKey && (e.Ch == 'a') && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
+				rateWindow++
+				if rateWindow == len(top.AverageWindows) {
+					rateWindow = INSTANT_RATES
+				}
+			}
+
+			if e.Type == ui.EventKey && (e.Ch == 'P') && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
+				if pause == nil {
+					pause = top.NewPause(engine.History)
+				} else {
+					held := pause.Resume()
+					pause = nil
+					for _, stats := range held {
+						update(stats)
+					}
+				}
+			}
+
+			if e.Type == ui.EventKey && (e.Ch == 'G') && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
+				groupBy = nextGroupBy(groupBy)
+			}
+
+			if e.Type == ui.EventKey && (e.Ch == 'p') && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
+				showDistribution = !showDistribution
 			}
 
-		case cause := <-redraw:
-			ui.Render(ui.Body)
+			if e.Type == ui.EventKey && (e.Ch == 'g') && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
+				showTrends = !showTrends
+			}
 
-			if cause == DueToNewStats {
-				numberOfRedrawsDueToNewStats += 1
+			if e.Type == ui.EventMouse && !(waitingSortOption || waitingLimitOption || waitingOrderOption || waitingFilterOption || waitingIntervalOption) {
+				if clicked, ok := tabAt(e.X); ok && e.Button == ui.ButtonLeft && e.Y == 0 && viewMode == TopViewMode {
+					tab = clicked
+					engine.SetTab(tab)
+				}
 
-				if *maxStatsRefreshes > 0 && numberOfRedrawsDueToNewStats >= *maxStatsRefreshes {
-					close(engine.ShutdownCh)
-					cleanExit()
+				_, height := renderer.Size()
+				v := view()
+				row, onTable := v.TableAt(e.Y, height)
+				switch {
+				case v.Table == nil:
+				case e.Button == ui.WheelUp:
+					v.Table.Scroll(-MOUSE_WHEEL_ROWS, v.TableRows(height))
+				case e.Button == ui.WheelDown:
+					v.Table.Scroll(MOUSE_WHEEL_ROWS, v.TableRows(height))
+				case e.Button != ui.ButtonLeft || !onTable:
+				case row >= 0:
+					v.Table.Cursor = row
+				case viewMode == TopViewMode && tab == top.TabConnections:
+					// Clicking the header of the column the connections are
+					// ordered by toggles the direction, or else orders by it
+					if column, ok := table.columnAt(e.X); ok {
+						current, desc := displayOrder(engine)
+						orderBy, orderDir = column, top.DirectionDefault
+						if column == current && desc {
+							orderDir = top.Ascending
+						} else if column == current {
+							orderDir = top.Descending
+						}
+						refresh()
+					}
 				}
+
+				if viewMode == TopViewMode && tab == top.TabConnections && tableView.Cursor < len(table.cids) {
+					selectedCid = table.cids[tableView.Cursor]
+				}
+			}
+
+			if e.Type == ui.EventResize {
+				resizeSparklines(e.Width)
 			}
+
+			engine.SetAccounts(displaysAccounts())
+			draw()
+		}
+	}
+}
+
+// promptRow returns the row where prompts are drawn in a view, the first
+// blank line below its header, added below the lines if there is none.
+func promptRow(view *ui.View) int {
+	for i, line := range view.Lines {
+		if i > 0 && strings.TrimSpace(line.Text) == "" {
+			return i
+		}
+	}
+	view.Lines = append(view.Lines, ui.Line{})
+	return len(view.Lines) - 1
+}
+
+// displaysAccounts returns whether the accounts of the connections are
+// displayed, ordered or grouped by, which the engine then requests.
+func displaysAccounts() bool {
+	return slices.Contains(displayColumns, top.ColumnAccount) || orderBy == top.ColumnAccount || groupBy == top.GroupByAccount
+}
+
+// saveColumns saves the displayed columns, so they are displayed the
+// next time nats-top is started, unless there is no config directory.
+func saveColumns() error {
+	path := columnsFile()
+	if path == "" {
+		return nil
+	}
+	return top.SaveColumns(path, displayColumns)
+}
+
+const columnsHelp = `
+Columns of the connections table
+
+up, down         Move the cursor over the columns.
+space            Show or hide the column under the cursor.
+left, right      Move the column under the cursor to the left or right.
+c, enter, esc    Go back to the connections.
+
+The columns are saved for the next time nats-top is started.
+`
+
+// nextGroupBy returns the group by option that follows the given one.
+func nextGroupBy(current top.GroupBy) top.GroupBy {
+	for i, opt := range top.GroupByOptions {
+		if opt == current {
+			return top.GroupByOptions[(i+1)%len(top.GroupByOptions)]
 		}
 	}
+	return top.GroupByNone
+}
+
+// rateWindowName describes the rates displayed in connections.
+func rateWindowName() string {
+	if rateWindow == INSTANT_RATES {
+		return "per second"
+	}
+	return fmt.Sprintf("%s avg", strings.TrimSuffix(top.AverageWindows[rateWindow].String(), "0s"))
+}
+
+// resizeSparklines fits two sparklines with their labels in the terminal width.
+func resizeSparklines(termWidth int) {
+	width := (termWidth - 40) / 2
+	if width < DEFAULT_SPARKLINE_WIDTH/2 {
+		width = DEFAULT_SPARKLINE_WIDTH / 2
+	}
+	if width > MAX_SPARKLINE_WIDTH {
+		width = MAX_SPARKLINE_WIDTH
+	}
+	sparklineWidth = width
 }
 
 func generateHelp() string {
@@ -769,10 +1850,32 @@ Command          Description
 o<option>        Set primary sort key to <option>.
 
                  Option can be one of: {cid|subs|pending|msgs_to|msgs_from|
-                 bytes_to|bytes_from|idle|last}
+                 bytes_to|bytes_from|idle|last|rtt}
+
+                 Prepend + or - to the option for displaying the polled
+                 connections in ascending or descending order, e.g. +subs.
+                 The server still picks which connections are polled.
 
                  This can be set in the command line too with -sort flag.
 
+O<column>        Order the polled connections by <column>, e.g. by their
+                 rates when displayed, while o<option> still picks which
+                 connections are polled. An empty column keeps the order
+                 of the server.
+
+                 Column can be one of: {host|cid|name|account|kind|subs|
+                 pending|msgs_to|msgs_from|bytes_to|bytes_from|rtt|tls|
+                 lang|version|uptime|last}
+
+                 Prepend + or - to the column for ascending or descending
+                 order, e.g. -name.
+
+                 This can be set in the command line too with -order flag.
+
+r<interval>      Set the refresh interval, e.g. 500ms, 5s or 1m, or a number
+                 of seconds as the -d flag takes it. The current one is
+                 shown in the tab bar.
+
 n<limit>         Set sample size of connections to request from the server.
 
                  This can be set in the command line as well via -n flag.
@@ -782,15 +1885,62 @@ n<limit>         Set sample size of connections to request from the server.
 
 s                Toggle displaying connection subscriptions.
 
+G                Cycle aggregating connections by name, ip, account and
+                 lang/version, or displaying each one of them.
+
+                 This can be set in the command line too with -group-by flag.
+
 d                Toggle activating DNS address lookup for clients.
 
 b                Toggle displaying raw bytes.
 
+g                Toggle displaying trends of the server metrics.
+
+p                Toggle displaying the distribution of pending bytes, msgs
+                 per second and subscriptions across connections.
+
+up, down         Move the cursor over the connections, scrolling them
+                 below the header. PgUp, PgDn, Home and End move it a
+                 page at a time or to the first and last connection.
+
+c                Open the column chooser, for showing, hiding and reordering
+                 the columns of the connections table, including the
+                 ACCOUNT, KIND and TLS ones. The chosen columns are saved
+                 for the next time nats-top is started.
+
+                 This can be set in the command line too with -columns flag.
+
+/<pattern>       Display only the connections with a host, name, account,
+                 lang/version or subscription containing <pattern>, or
+                 matching it as a regular expression, ignoring case.
+                 An empty pattern or esc displays all of them again.
+
+enter            Open the detail of the connection under the cursor, with
+                 its subscriptions and charts of its rates, refreshed on
+                 every poll. Press enter or esc to go back.
+
+P                Pause or resume refreshing the display, which stays on
+                 the stats and trends polled when it was paused while the
+                 polling goes on.
+
+1-7              Switch between the Server, Connections, Routes, Gateways,
+                 Leafs, JetStream and Accounts tabs, which can be clicked in
+                 the tab bar too. Only the endpoints of the displayed tab
+                 are polled, and the other keys apply to the connections.
+
+mouse            Click the header of a column to order the connections
+                 by it, and again to toggle the direction. Click a row to
+                 select it and scroll with the wheel.
+
 space            Toggle displaying rates per second in connections.
 
+a                Cycle the rates displayed in connections between the
+                 ones per second and their 1m, 5m and 15m moving averages.
+
 q                Quit nats-top.
 
-Press any key to continue...
+Scroll with up, down, pgup, pgdn, home and end, or press any other key
+to continue...
 
 `
 	return text
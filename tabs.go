@@ -0,0 +1,382 @@
+// Copyright (c) 2026 The NATS Authors
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats-top/ui"
+	top "github.com/nats-io/nats-top/util"
+)
+
+// generateTabBar returns the line with the tabs and the number keys
+// switching to them, the current one reversed, and the refresh interval.
+func generateTabBar(current top.Tab, interval time.Duration) ui.Line {
+	var line ui.Line
+	for i, tab := range top.Tabs {
+		label := fmt.Sprintf(" %d %s ", i+1, tab)
+		if tab == current {
+			start := utf8.RuneCountInString(line.Text)
+			line.Spans = append(line.Spans, ui.Span{Start: start, End: start + len(label), Style: ui.Style{Bold: true, Reverse: true}})
+		}
+		line.Text += label + " "
+	}
+	line.Text += fmt.Sprintf(" Refresh: %s", interval)
+	return line
+}
+
+// tabAt returns the tab at x in the tab bar, if there is one.
+func tabAt(x int) (top.Tab, bool) {
+	start := 0
+	for i, tab := range top.Tabs {
+		end := start + len(fmt.Sprintf(" %d %s ", i+1, tab))
+		if x >= start && x < end {
+			return tab, true
+		}
+		start = end + 1
+	}
+	return top.TabConnections, false
+}
+
+// generateTab returns the header and the table of a tab other than the
+// connections one, from the stats last polled for it, if there are any.
+func generateTab(tab top.Tab, stats *top.Stats) (string, *connsTable) {
+	if stats == nil {
+		return fmt.Sprintf("Polling %s\n", strings.Join(tab.Endpoints(), ", ")), &connsTable{}
+	}
+
+	switch tab {
+	case top.TabServer:
+		return generateServerTab(stats), &connsTable{}
+	case top.TabRoutes:
+		return generateRoutesTab(stats)
+	case top.TabGateways:
+		return generateGatewaysTab(stats)
+	case top.TabLeafs:
+		return generateLeafsTab(stats)
+	case top.TabJetStream:
+		return generateJetStreamTab(stats)
+	case top.TabAccounts:
+		return generateAccountsTab(stats)
+	}
+	return "", &connsTable{}
+}
+
+// generateTable returns a table with the given header and rows, each
+// column as wide as its widest value.
+func generateTable(header []string, rows [][]string) *connsTable {
+	widths := make([]int, len(header))
+	for j, h := range header {
+		widths[j] = len(h)
+	}
+	for _, row := range rows {
+		for j, v := range row {
+			widths[j] = max(widths[j], utf8.RuneCountInString(v))
+		}
+	}
+
+	line := func(values []string) string {
+		var b strings.Builder
+		b.WriteString(DEFAULT_PADDING)
+		for j, v := range values {
+			fmt.Fprintf(&b, "%-*s  ", widths[j], v)
+		}
+		return strings.TrimRight(b.String(), " ") + "\n"
+	}
+
+	table := &connsTable{header: line(header)}
+	for _, row := range rows {
+		table.rows = append(table.rows, line(row))
+	}
+	return table
+}
+
+// orNone returns a dash for an empty value.
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// generateServerTab returns the details of the server, its limits and
+// the ones of the clusters, gateways, leafnodes and JetStream it is in.
+func generateServerTab(stats *top.Stats) string {
+	varz := stats.Varz
+	text := fmt.Sprintf("NATS server version %s (uptime: %s) %s\n", varz.Version, varz.Uptime, pollStatus(stats))
+	if varz.ID == "" {
+		return text
+	}
+
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	listen := func(name, host string, port int) string {
+		if port == 0 {
+			return "-"
+		}
+		return strings.TrimSpace(fmt.Sprintf("%s %s:%d", name, host, port))
+	}
+
+	jetstream := "disabled"
+	if js := varz.JetStream; js.Config != nil {
+		jetstream = fmt.Sprintf("enabled  Domain: %s", orNone(js.Config.Domain))
+		if js.Stats != nil {
+			jetstream += fmt.Sprintf("  Memory: %s of %s  Storage: %s of %s",
+				top.Psize(*displayRawBytes, int64(js.Stats.Memory)), top.Psize(*displayRawBytes, js.Config.MaxMemory),
+				top.Psize(*displayRawBytes, int64(js.Stats.Store)), top.Psize(*displayRawBytes, js.Config.MaxStore))
+		}
+	}
+
+	serverName := varz.Name
+	if serverName == varz.ID {
+		serverName = ""
+	}
+
+	info := "Server: %s\n"
+	info += "  ID:        %s\n"
+	info += "  Go:        %s  Git: %s  Proto: %d\n"
+	info += "  Listen:    %s:%d  Monitoring: %s:%d\n"
+	info += "  Started:   %s  Config Loaded: %s\n"
+	info += "  Load:      CPU:  %.1f%%  Memory: %s  Cores: %d  GOMAXPROCS: %d\n"
+	info += "  Clients:   Connections: %d  Total: %d  Subscriptions: %d  Slow Consumers: %d\n"
+	info += "  In:        Msgs: %s  Bytes: %s\n"
+	info += "  Out:       Msgs: %s  Bytes: %s\n"
+	info += "  Limits:    Connections: %d  Payload: %s  Pending: %s  Control Line: %d\n"
+	info += "  Security:  Auth Required: %s  TLS Required: %s  TLS Verify: %s\n"
+	info += "  Pings:     Interval: %s  Max Out: %d\n"
+	info += "\n"
+	info += "  Cluster:   %s  Routes: %d\n"
+	info += "  Gateway:   %s  Remotes: %d\n"
+	info += "  Leafnodes: %s  Connected: %d\n"
+	info += "  JetStream: %s\n"
+	text += fmt.Sprintf(info,
+		orNone(serverName),
+		varz.ID,
+		varz.GoVersion, orNone(varz.GitCommit), varz.Proto,
+		varz.Host, varz.Port, varz.HTTPHost, max(varz.HTTPPort, varz.HTTPSPort),
+		varz.Start.Format(time.DateTime), varz.ConfigLoadTime.Format(time.DateTime),
+		varz.CPU, top.Psize(false, varz.Mem), varz.Cores, varz.MaxProcs,
+		varz.Connections, varz.TotalConnections, varz.Subscriptions, varz.SlowConsumers,
+		top.Nsize(*displayRawBytes, varz.InMsgs), top.Psize(*displayRawBytes, varz.InBytes),
+		top.Nsize(*displayRawBytes, varz.OutMsgs), top.Psize(*displayRawBytes, varz.OutBytes),
+		varz.MaxConn, top.Psize(*displayRawBytes, int64(varz.MaxPayload)), top.Psize(*displayRawBytes, varz.MaxPending), varz.MaxControlLine,
+		yesNo(varz.AuthRequired), yesNo(varz.TLSRequired), yesNo(varz.TLSVerify),
+		varz.PingInterval, varz.MaxPingsOut,
+		listen(varz.Cluster.Name, varz.Cluster.Host, varz.Cluster.Port), varz.Routes,
+		listen(varz.Gateway.Name, varz.Gateway.Host, varz.Gateway.Port), varz.Remotes,
+		listen("", varz.LeafNode.Host, varz.LeafNode.Port), varz.Leafs,
+		jetstream,
+	)
+	return text
+}
+
+// generateRoutesTab returns the routes to the other servers of the cluster.
+func generateRoutesTab(stats *top.Stats) (string, *connsTable) {
+	routez := stats.Routez
+	if routez == nil {
+		return fmt.Sprintf("Routes  %s\n", pollStatus(stats)), &connsTable{}
+	}
+	text := fmt.Sprintf("Routes: %d  %s\n\n", routez.NumRoutes, pollStatus(stats))
+
+	routes := slices.Clone(routez.Routes)
+	slices.SortFunc(routes, func(a, b *server.RouteInfo) int { return cmp.Compare(a.Rid, b.Rid) })
+
+	var rows [][]string
+	for _, route := range routes {
+		remote := route.RemoteName
+		if remote == "" {
+			remote = route.RemoteID
+		}
+		dir := "in"
+		if route.DidSolicit {
+			dir = "out"
+		}
+		rows = append(rows, []string{
+			fmt.Sprint(route.Rid), remote, fmt.Sprintf("%s:%d", route.IP, route.Port), dir, orNone(route.Account),
+			top.FormatRTT(route.RTT), top.Psize(*displayRawBytes, int64(route.Pending)),
+			top.Nsize(*displayRawBytes, route.OutMsgs), top.Nsize(*displayRawBytes, route.InMsgs),
+			top.Psize(*displayRawBytes, route.OutBytes), top.Psize(*displayRawBytes, route.InBytes),
+			fmt.Sprint(route.NumSubs), route.Uptime, route.Idle,
+		})
+	}
+
+	header := []string{"RID", "REMOTE", "ADDRESS", "DIR", "ACCOUNT", "RTT", "PENDING", "MSGS_TO", "MSGS_FROM", "BYTES_TO", "BYTES_FROM", "SUBS", "UPTIME", "IDLE"}
+	return text, generateTable(header, rows)
+}
+
+// generateGatewaysTab returns the outbound and inbound connections to
+// the gateways of the other clusters.
+func generateGatewaysTab(stats *top.Stats) (string, *connsTable) {
+	gatewayz := stats.Gatewayz
+	if gatewayz == nil {
+		return fmt.Sprintf("Gateways  %s\n", pollStatus(stats)), &connsTable{}
+	}
+
+	var rows [][]string
+	row := func(dir, name string, gw *server.RemoteGatewayz) {
+		conn := gw.Connection
+		if conn == nil {
+			rows = append(rows, []string{dir, name})
+			return
+		}
+		rows = append(rows, []string{
+			dir, name, fmt.Sprint(conn.Cid), fmt.Sprintf("%s:%d", conn.IP, conn.Port),
+			top.FormatRTT(conn.RTT), top.Psize(*displayRawBytes, int64(conn.Pending)),
+			top.Nsize(*displayRawBytes, conn.OutMsgs), top.Nsize(*displayRawBytes, conn.InMsgs),
+			top.Psize(*displayRawBytes, conn.OutBytes), top.Psize(*displayRawBytes, conn.InBytes),
+			conn.Uptime, conn.Idle,
+		})
+	}
+
+	inbound := 0
+	for _, name := range slices.Sorted(maps.Keys(gatewayz.OutboundGateways)) {
+		row("out", name, gatewayz.OutboundGateways[name])
+	}
+	for _, name := range slices.Sorted(maps.Keys(gatewayz.InboundGateways)) {
+		for _, gw := range gatewayz.InboundGateways[name] {
+			row("in", name, gw)
+			inbound++
+		}
+	}
+
+	text := fmt.Sprintf("Gateway: %s  Outbound: %d  Inbound: %d  %s\n\n",
+		orNone(gatewayz.Name), len(gatewayz.OutboundGateways), inbound, pollStatus(stats))
+	header := []string{"DIR", "GATEWAY", "CID", "ADDRESS", "RTT", "PENDING", "MSGS_TO", "MSGS_FROM", "BYTES_TO", "BYTES_FROM", "UPTIME", "IDLE"}
+	return text, generateTable(header, rows)
+}
+
+// generateLeafsTab returns the connections of the leafnodes.
+func generateLeafsTab(stats *top.Stats) (string, *connsTable) {
+	leafz := stats.Leafz
+	if leafz == nil {
+		return fmt.Sprintf("Leafnodes  %s\n", pollStatus(stats)), &connsTable{}
+	}
+	text := fmt.Sprintf("Leafnodes: %d  %s\n\n", leafz.NumLeafs, pollStatus(stats))
+
+	leafs := slices.Clone(leafz.Leafs)
+	slices.SortFunc(leafs, func(a, b *server.LeafInfo) int { return cmp.Compare(a.ID, b.ID) })
+
+	var rows [][]string
+	for _, leaf := range leafs {
+		spoke := ""
+		if leaf.IsSpoke {
+			spoke = "yes"
+		}
+		rows = append(rows, []string{
+			fmt.Sprint(leaf.ID), leaf.Name, leaf.Account, fmt.Sprintf("%s:%d", leaf.IP, leaf.Port),
+			top.FormatRTT(leaf.RTT), spoke,
+			top.Nsize(*displayRawBytes, leaf.OutMsgs), top.Nsize(*displayRawBytes, leaf.InMsgs),
+			top.Psize(*displayRawBytes, leaf.OutBytes), top.Psize(*displayRawBytes, leaf.InBytes),
+			fmt.Sprint(leaf.NumSubs), leaf.Compression,
+		})
+	}
+
+	header := []string{"ID", "NAME", "ACCOUNT", "ADDRESS", "RTT", "SPOKE", "MSGS_TO", "MSGS_FROM", "BYTES_TO", "BYTES_FROM", "SUBS", "COMPRESSION"}
+	return text, generateTable(header, rows)
+}
+
+// generateJetStreamTab returns the usage of JetStream on the server and
+// the one of each account.
+func generateJetStreamTab(stats *top.Stats) (string, *connsTable) {
+	jsz := stats.Jsz
+	if jsz == nil {
+		return fmt.Sprintf("JetStream  %s\n", pollStatus(stats)), &connsTable{}
+	}
+	if jsz.Disabled {
+		return fmt.Sprintf("JetStream: disabled  %s\n", pollStatus(stats)), &connsTable{}
+	}
+
+	size := func(v uint64) string {
+		return top.Psize(*displayRawBytes, int64(v))
+	}
+
+	info := "JetStream  %s\n"
+	info += "  Domain:    %s  Store: %s\n"
+	info += "  Memory:    %s of %s  Reserved: %s\n"
+	info += "  Storage:   %s of %s  Reserved: %s\n"
+	info += "  Streams:   %d  Consumers: %d  Messages: %s  Bytes: %s\n"
+	info += "  API:       Total: %s  Errors: %s  Inflight: %d\n"
+	text := fmt.Sprintf(info,
+		pollStatus(stats),
+		orNone(jsz.Config.Domain), orNone(jsz.Config.StoreDir),
+		size(jsz.Memory), top.Psize(*displayRawBytes, jsz.Config.MaxMemory), size(jsz.ReservedMemory),
+		size(jsz.Store), top.Psize(*displayRawBytes, jsz.Config.MaxStore), size(jsz.ReservedStore),
+		jsz.Streams, jsz.Consumers, top.Nsize(*displayRawBytes, int64(jsz.Messages)), size(jsz.Bytes),
+		top.Nsize(*displayRawBytes, int64(jsz.API.Total)), top.Nsize(*displayRawBytes, int64(jsz.API.Errors)), jsz.API.Inflight,
+	)
+	if meta := jsz.Meta; meta != nil {
+		text += fmt.Sprintf("  Meta:      %s  Leader: %s  Size: %d  Pending: %d\n", orNone(meta.Name), orNone(meta.Leader), meta.Size, meta.Pending)
+	}
+	text += fmt.Sprintf("\nAccounts: %d\n", len(jsz.AccountDetails))
+
+	accounts := slices.Clone(jsz.AccountDetails)
+	slices.SortFunc(accounts, func(a, b *server.AccountDetail) int { return strings.Compare(a.Name, b.Name) })
+
+	var rows [][]string
+	for _, account := range accounts {
+		rows = append(rows, []string{
+			account.Name, size(account.Memory), size(account.Store),
+			size(account.ReservedMemory), size(account.ReservedStore),
+			top.Nsize(*displayRawBytes, int64(account.API.Total)), top.Nsize(*displayRawBytes, int64(account.API.Errors)),
+		})
+	}
+
+	header := []string{"ACCOUNT", "MEMORY", "STORAGE", "RESERVED_MEMORY", "RESERVED_STORAGE", "API_TOTAL", "API_ERRORS"}
+	return text, generateTable(header, rows)
+}
+
+// generateAccountsTab returns the connections and traffic of each account.
+func generateAccountsTab(stats *top.Stats) (string, *connsTable) {
+	accstatz := stats.Accstatz
+	if accstatz == nil {
+		return fmt.Sprintf("Accounts  %s\n", pollStatus(stats)), &connsTable{}
+	}
+	text := fmt.Sprintf("Accounts: %d  %s\n\n", len(accstatz.Accounts), pollStatus(stats))
+
+	accounts := slices.Clone(accstatz.Accounts)
+	slices.SortFunc(accounts, func(a, b *server.AccountStat) int { return strings.Compare(a.Account, b.Account) })
+
+	var rows [][]string
+	for _, account := range accounts {
+		name := account.Account
+		if account.Name != "" && account.Name != name {
+			name += fmt.Sprintf(" (%s)", account.Name)
+		}
+		rows = append(rows, []string{
+			name, fmt.Sprint(account.Conns), fmt.Sprint(account.LeafNodes), fmt.Sprint(account.TotalConns), fmt.Sprint(account.NumSubs),
+			top.Nsize(*displayRawBytes, account.Sent.Msgs), top.Nsize(*displayRawBytes, account.Received.Msgs),
+			top.Psize(*displayRawBytes, account.Sent.Bytes), top.Psize(*displayRawBytes, account.Received.Bytes),
+			fmt.Sprint(account.SlowConsumers),
+		})
+	}
+
+	header := []string{"ACCOUNT", "CONNS", "LEAFS", "TOTAL_CONNS", "SUBS", "MSGS_TO", "MSGS_FROM", "BYTES_TO", "BYTES_FROM", "SLOW_CONSUMERS"}
+	return text, generateTable(header, rows)
+}
+
+// polledAt returns when the stats were polled, as reported by the server.
+func polledAt(stats *top.Stats) time.Time {
+	switch {
+	case stats.Routez != nil:
+		return stats.Routez.Now
+	case stats.Gatewayz != nil:
+		return stats.Gatewayz.Now
+	case stats.Leafz != nil:
+		return stats.Leafz.Now
+	case stats.Jsz != nil:
+		return stats.Jsz.Now
+	case stats.Accstatz != nil:
+		return stats.Accstatz.Now
+	}
+	return stats.Varz.Now
+}
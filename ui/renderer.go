@@ -0,0 +1,288 @@
+// Package ui is the layer between what nats-top displays and the terminal,
+// so that views are built as plain lines of text and the terminal library
+// drawing them can be replaced.
+package ui
+
+// Color is a terminal color.
+type Color int
+
+const (
+	ColorDefault Color = iota
+	ColorBlack
+	ColorRed
+	ColorGreen
+	ColorYellow
+	ColorBlue
+	ColorMagenta
+	ColorCyan
+	ColorWhite
+	ColorGray
+)
+
+// Style is how text is drawn.
+type Style struct {
+	Fg      Color
+	Bg      Color
+	Bold    bool
+	Reverse bool
+}
+
+// Line is a line of text drawn with a style, except for the spans of it
+// drawn with their own.
+type Line struct {
+	Text  string
+	Style Style
+	Spans []Span
+}
+
+// Span is a part of a line, from the Start rune up to the End one
+// excluded, drawn with its own style.
+type Span struct {
+	Start int
+	End   int
+	Style Style
+}
+
+// StyleAt returns the style of the rune at index i of the line.
+func (l *Line) StyleAt(i int) Style {
+	for _, span := range l.Spans {
+		if i >= span.Start && i < span.End {
+			return span.Style
+		}
+	}
+	return l.Style
+}
+
+// View is what is drawn on the screen: lines from the top of it, clipped
+// to its size, a table filling the rest of it if there is one, and a
+// prompt drawn over one of the lines when there is one.
+type View struct {
+	Lines     []Line
+	Table     *Table
+	Prompt    string
+	PromptRow int
+}
+
+// TableRows returns how many rows of the table fit below the lines and
+// the header of the table on a screen of the given height.
+func (v *View) TableRows(height int) int {
+	return height - len(v.Lines) - 1
+}
+
+// TableAt returns what is at line y of a screen of the given height in the
+// table: the index of a row, or -1 for its header, and whether there is one.
+func (v *View) TableAt(y, height int) (int, bool) {
+	if v.Table == nil || y < len(v.Lines) {
+		return 0, false
+	}
+	if y == len(v.Lines) {
+		return -1, true
+	}
+	i := y - len(v.Lines) - 1
+	row := v.Table.Offset + i
+	if i >= v.TableRows(height) || row >= len(v.Table.Rows) {
+		return 0, false
+	}
+	return row, true
+}
+
+// Table is a list of rows under a header that stays pinned while
+// scrolling through them, with a cursor on the selected row.
+type Table struct {
+	Header Line
+	Rows   []Line
+
+	// Cursor is the index of the selected row.
+	Cursor int
+
+	// Offset is the index of the first row shown.
+	Offset int
+}
+
+// Move moves the cursor for the navigation keys, given how many rows
+// are shown at once, and reports whether the key was one of them.
+func (t *Table) Move(key Key, page int) bool {
+	switch key {
+	case KeyUp:
+		t.Cursor--
+	case KeyDown:
+		t.Cursor++
+	case KeyPgUp:
+		t.Cursor -= page
+	case KeyPgDn:
+		t.Cursor += page
+	case KeyHome:
+		t.Cursor = 0
+	case KeyEnd:
+		t.Cursor = len(t.Rows) - 1
+	default:
+		return false
+	}
+	t.Fit(page)
+	return true
+}
+
+// Scroll scrolls the table by a number of rows, towards the first one if
+// negative, given how many rows are shown at once, keeping the cursor on
+// a shown row.
+func (t *Table) Scroll(rows, page int) {
+	if page < 1 {
+		page = 1
+	}
+	t.Offset += rows
+	t.Offset = min(t.Offset, len(t.Rows)-page)
+	t.Offset = max(t.Offset, 0)
+
+	t.Cursor = max(t.Cursor, t.Offset)
+	t.Cursor = min(t.Cursor, t.Offset+page-1)
+	t.Fit(page)
+}
+
+// Fit keeps the cursor within the rows and scrolls the table, given
+// how many rows are shown at once, so that the cursor is shown.
+func (t *Table) Fit(page int) {
+	if page < 1 {
+		page = 1
+	}
+	t.Cursor = min(t.Cursor, len(t.Rows)-1)
+	t.Cursor = max(t.Cursor, 0)
+
+	if t.Cursor < t.Offset {
+		t.Offset = t.Cursor
+	}
+	if t.Cursor >= t.Offset+page {
+		t.Offset = t.Cursor - page + 1
+	}
+	t.Offset = min(t.Offset, len(t.Rows)-page)
+	t.Offset = max(t.Offset, 0)
+}
+
+// Text is lines longer than fit on the screen, scrolled through with the
+// same navigation keys as a table.
+type Text struct {
+	Lines []Line
+
+	// Offset is the index of the first line shown.
+	Offset int
+}
+
+// Move scrolls the text for the navigation keys, given how many lines
+// are shown at once, and reports whether the key was one of them.
+func (t *Text) Move(key Key, page int) bool {
+	switch key {
+	case KeyUp:
+		t.Offset--
+	case KeyDown:
+		t.Offset++
+	case KeyPgUp:
+		t.Offset -= page
+	case KeyPgDn:
+		t.Offset += page
+	case KeyHome:
+		t.Offset = 0
+	case KeyEnd:
+		t.Offset = len(t.Lines)
+	default:
+		return false
+	}
+	t.Offset = min(t.Offset, len(t.Lines)-page)
+	t.Offset = max(t.Offset, 0)
+	return true
+}
+
+// Shown returns the lines from the first one shown.
+func (t *Text) Shown() []Line {
+	return t.Lines[min(t.Offset, len(t.Lines)):]
+}
+
+// Lines splits text into lines drawn with the same style.
+func Lines(text string, style Style) []Line {
+	var lines []Line
+	start := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lines = append(lines, Line{Text: text[start:i], Style: style})
+			start = i + 1
+		}
+	}
+	if start < len(text) {
+		lines = append(lines, Line{Text: text[start:], Style: style})
+	}
+	return lines
+}
+
+// EventType is the kind of an Event.
+type EventType int
+
+const (
+	EventKey EventType = iota
+	EventResize
+	EventMouse
+)
+
+// Key is a key that was pressed, KeyRune being any printable character.
+type Key int
+
+const (
+	KeyRune Key = iota
+	KeyEnter
+	KeyBackspace
+	KeyEsc
+	KeyCtrlC
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyPgUp
+	KeyPgDn
+	KeyHome
+	KeyEnd
+	KeyTab
+	KeyUnknown
+)
+
+// Button is a mouse button that was pressed, or the wheel being scrolled.
+type Button int
+
+const (
+	ButtonNone Button = iota
+	ButtonLeft
+	ButtonRight
+	WheelUp
+	WheelDown
+)
+
+// Event is an input event or a change of the size of the screen.
+type Event struct {
+	Type EventType
+	Key  Key
+	Ch   rune
+
+	// Button is the mouse button pressed at X and Y on mouse events.
+	Button Button
+	X      int
+	Y      int
+
+	// Width and Height are the new size of the screen on resize.
+	Width  int
+	Height int
+}
+
+// Renderer draws views on a terminal and reports its input events.
+type Renderer interface {
+	// Init takes over the terminal.
+	Init() error
+
+	// Close gives the terminal back as it was before Init.
+	Close()
+
+	// Size returns the width and height of the screen.
+	Size() (width, height int)
+
+	// Draw replaces what is on the screen with the view.
+	Draw(view *View)
+
+	// Events returns the channel of input and resize events,
+	// which is closed when the renderer is closed.
+	Events() <-chan Event
+}
@@ -0,0 +1,173 @@
+package ui_test
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats-top/ui"
+)
+
+func TestLines(t *testing.T) {
+	style := ui.Style{Fg: ui.ColorRed}
+	lines := ui.Lines("header\n\n  row\n", style)
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got: %+v", lines)
+	}
+	for i, want := range []string{"header", "", "  row"} {
+		if lines[i].Text != want || lines[i].Style != style {
+			t.Fatalf("Expected line %d to be %q, got: %+v", i, want, lines[i])
+		}
+	}
+
+	if lines := ui.Lines("", style); len(lines) != 0 {
+		t.Fatalf("Expected no lines, got: %+v", lines)
+	}
+}
+
+func TestLineStyleAt(t *testing.T) {
+	red := ui.Style{Fg: ui.ColorRed}
+	line := ui.Line{Text: "0123456789", Style: ui.Style{Bold: true}, Spans: []ui.Span{{Start: 2, End: 5, Style: red}}}
+	for i := range len(line.Text) {
+		want := line.Style
+		if i >= 2 && i < 5 {
+			want = red
+		}
+		if got := line.StyleAt(i); got != want {
+			t.Fatalf("Expected style %+v at %d, got: %+v", want, i, got)
+		}
+	}
+}
+
+func TestTableMove(t *testing.T) {
+	table := &ui.Table{Rows: ui.Lines("0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n", ui.Style{})}
+
+	steps := []struct {
+		key    ui.Key
+		cursor int
+		offset int
+	}{
+		{ui.KeyUp, 0, 0},
+		{ui.KeyDown, 1, 0},
+		{ui.KeyPgDn, 5, 2},
+		{ui.KeyDown, 6, 3},
+		{ui.KeyEnd, 9, 6},
+		{ui.KeyPgDn, 9, 6},
+		{ui.KeyPgUp, 5, 5},
+		{ui.KeyHome, 0, 0},
+	}
+	for _, step := range steps {
+		if !table.Move(step.key, 4) {
+			t.Fatalf("Expected key %v to move the cursor", step.key)
+		}
+		if table.Cursor != step.cursor || table.Offset != step.offset {
+			t.Fatalf("Expected cursor %d and offset %d after key %v, got: %d and %d",
+				step.cursor, step.offset, step.key, table.Cursor, table.Offset)
+		}
+	}
+
+	if table.Move(ui.KeyRune, 4) {
+		t.Fatal("Expected other keys not to move the cursor")
+	}
+
+	// Rows going away bring the cursor back within them
+	table.Cursor, table.Offset = 9, 6
+	table.Rows = table.Rows[:3]
+	table.Fit(4)
+	if table.Cursor != 2 || table.Offset != 0 {
+		t.Fatalf("Expected cursor on the last row, got: %d and offset %d", table.Cursor, table.Offset)
+	}
+}
+
+func TestTableScroll(t *testing.T) {
+	table := &ui.Table{Rows: ui.Lines("0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n", ui.Style{}), Cursor: 1}
+
+	steps := []struct {
+		rows   int
+		cursor int
+		offset int
+	}{
+		{3, 3, 3},
+		{3, 6, 6},
+		{3, 6, 6},
+		{-1, 6, 5},
+		{-10, 3, 0},
+	}
+	for _, step := range steps {
+		table.Scroll(step.rows, 4)
+		if table.Cursor != step.cursor || table.Offset != step.offset {
+			t.Fatalf("Expected cursor %d and offset %d after scrolling %d rows, got: %d and %d",
+				step.cursor, step.offset, step.rows, table.Cursor, table.Offset)
+		}
+	}
+}
+
+func TestTextMove(t *testing.T) {
+	text := &ui.Text{Lines: ui.Lines("0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n", ui.Style{})}
+
+	steps := []struct {
+		key    ui.Key
+		offset int
+	}{
+		{ui.KeyUp, 0},
+		{ui.KeyDown, 1},
+		{ui.KeyPgDn, 5},
+		{ui.KeyPgDn, 6},
+		{ui.KeyPgUp, 2},
+		{ui.KeyEnd, 6},
+		{ui.KeyHome, 0},
+	}
+	for _, step := range steps {
+		if !text.Move(step.key, 4) {
+			t.Fatalf("Expected key %v to scroll the text", step.key)
+		}
+		if text.Offset != step.offset {
+			t.Fatalf("Expected offset %d after key %v, got: %d", step.offset, step.key, text.Offset)
+		}
+	}
+	if text.Move(ui.KeyRune, 4) {
+		t.Fatal("Expected other keys not to scroll the text")
+	}
+
+	text.Move(ui.KeyEnd, 4)
+	if shown := text.Shown(); len(shown) != 4 || shown[0].Text != "6" {
+		t.Fatalf("Expected the last 4 lines shown, got: %+v", shown)
+	}
+
+	// Text that fits is not scrolled
+	text.Lines = text.Lines[:3]
+	if text.Move(ui.KeyDown, 4); text.Offset != 0 {
+		t.Fatalf("Expected no offset of text that fits, got: %d", text.Offset)
+	}
+}
+
+func TestViewTableAt(t *testing.T) {
+	view := &ui.View{
+		Lines: ui.Lines("header\n\n", ui.Style{}),
+		Table: &ui.Table{Rows: ui.Lines("0\n1\n2\n3\n4\n5\n", ui.Style{}), Offset: 2},
+	}
+
+	for y, want := range map[int]struct {
+		row int
+		ok  bool
+	}{
+		0: {0, false},
+		1: {0, false},
+		2: {-1, true},
+		3: {2, true},
+		5: {4, true},
+		6: {0, false},
+	} {
+		// Only three rows fit below the lines and the header
+		if row, ok := view.TableAt(y, 6); row != want.row || ok != want.ok {
+			t.Fatalf("Expected row %d (%v) at line %d, got: %d (%v)", want.row, want.ok, y, row, ok)
+		}
+	}
+
+	view.Table.Offset = 4
+	if _, ok := view.TableAt(5, 6); ok {
+		t.Fatal("Expected no row past the last one")
+	}
+
+	if _, ok := (&ui.View{}).TableAt(0, 6); ok {
+		t.Fatal("Expected no table")
+	}
+}
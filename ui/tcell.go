@@ -0,0 +1,217 @@
+package ui
+
+import (
+	"sync"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/mattn/go-runewidth"
+)
+
+// TcellRenderer is a Renderer built on tcell.
+type TcellRenderer struct {
+	screen tcell.Screen
+	events chan Event
+	once   sync.Once
+
+	// buttons are the mouse buttons held down, as tcell
+	// reports which are rather than which were pressed.
+	buttons tcell.ButtonMask
+}
+
+// NewTcellRenderer returns a renderer drawing on the given screen,
+// or on the terminal if it is nil.
+func NewTcellRenderer(screen tcell.Screen) *TcellRenderer {
+	return &TcellRenderer{screen: screen, events: make(chan Event, 16)}
+}
+
+// Init implements Renderer.
+func (r *TcellRenderer) Init() error {
+	if r.screen == nil {
+		screen, err := tcell.NewScreen()
+		if err != nil {
+			return err
+		}
+		r.screen = screen
+	}
+	if err := r.screen.Init(); err != nil {
+		return err
+	}
+	r.screen.HideCursor()
+	r.screen.EnableMouse()
+	r.screen.Clear()
+
+	go r.pollEvents()
+
+	return nil
+}
+
+// Close implements Renderer.
+func (r *TcellRenderer) Close() {
+	r.once.Do(r.screen.Fini)
+}
+
+// Size implements Renderer.
+func (r *TcellRenderer) Size() (int, int) {
+	return r.screen.Size()
+}
+
+// Events implements Renderer.
+func (r *TcellRenderer) Events() <-chan Event {
+	return r.events
+}
+
+// Draw implements Renderer.
+func (r *TcellRenderer) Draw(view *View) {
+	r.screen.Clear()
+
+	width, height := r.screen.Size()
+	for y, line := range view.Lines {
+		if y >= height {
+			break
+		}
+		if view.Prompt != "" && y == view.PromptRow {
+			continue
+		}
+		r.drawLine(y, line, false)
+	}
+
+	if t := view.Table; t != nil && len(view.Lines) < height {
+		y := len(view.Lines)
+		r.drawLine(y, t.Header, false)
+
+		page := view.TableRows(height)
+		t.Fit(page)
+		for i := t.Offset; i < len(t.Rows) && i < t.Offset+page; i++ {
+			y++
+			if i == t.Cursor {
+				// The cursor spans the whole width of the screen
+				style := t.Rows[i].Style
+				style.Reverse = true
+				for x := 0; x < width; x++ {
+					r.screen.SetContent(x, y, ' ', nil, tcellStyle(style))
+				}
+			}
+			r.drawLine(y, t.Rows[i], i == t.Cursor)
+		}
+	}
+
+	if view.Prompt != "" {
+		r.drawLine(view.PromptRow, Line{Text: view.Prompt}, false)
+	}
+
+	r.screen.Show()
+}
+
+// drawLine draws a line at row y, reversed under the cursor and clipped
+// to the width of the screen.
+func (r *TcellRenderer) drawLine(y int, line Line, reverse bool) {
+	width, _ := r.screen.Size()
+	x := 0
+	for i, ch := range []rune(line.Text) {
+		w := runewidth.RuneWidth(ch)
+		if w == 0 {
+			continue
+		}
+		if x+w > width {
+			return
+		}
+		style := line.StyleAt(i)
+		style.Reverse = style.Reverse || reverse
+		r.screen.SetContent(x, y, ch, nil, tcellStyle(style))
+		x += w
+	}
+}
+
+func (r *TcellRenderer) pollEvents() {
+	defer close(r.events)
+
+	for {
+		switch ev := r.screen.PollEvent().(type) {
+		case nil:
+			// The screen was finalized
+			return
+		case *tcell.EventResize:
+			r.screen.Sync()
+			width, height := ev.Size()
+			r.events <- Event{Type: EventResize, Width: width, Height: height}
+		case *tcell.EventKey:
+			r.events <- keyEvent(ev)
+		case *tcell.EventMouse:
+			if e, ok := r.mouseEvent(ev); ok {
+				r.events <- e
+			}
+		}
+	}
+}
+
+var tcellKeys = map[tcell.Key]Key{
+	tcell.KeyEnter:      KeyEnter,
+	tcell.KeyBackspace:  KeyBackspace,
+	tcell.KeyBackspace2: KeyBackspace,
+	tcell.KeyEscape:     KeyEsc,
+	tcell.KeyCtrlC:      KeyCtrlC,
+	tcell.KeyUp:         KeyUp,
+	tcell.KeyDown:       KeyDown,
+	tcell.KeyLeft:       KeyLeft,
+	tcell.KeyRight:      KeyRight,
+	tcell.KeyPgUp:       KeyPgUp,
+	tcell.KeyPgDn:       KeyPgDn,
+	tcell.KeyHome:       KeyHome,
+	tcell.KeyEnd:        KeyEnd,
+	tcell.KeyTab:        KeyTab,
+}
+
+func keyEvent(ev *tcell.EventKey) Event {
+	if ev.Key() == tcell.KeyRune {
+		return Event{Type: EventKey, Key: KeyRune, Ch: ev.Rune()}
+	}
+	if key, ok := tcellKeys[ev.Key()]; ok {
+		return Event{Type: EventKey, Key: key}
+	}
+	return Event{Type: EventKey, Key: KeyUnknown}
+}
+
+// mouseEvent returns the event for a button being pressed or the wheel
+// being scrolled, or false for the mouse being moved or released.
+func (r *TcellRenderer) mouseEvent(ev *tcell.EventMouse) (Event, bool) {
+	buttons := ev.Buttons()
+	pressed := buttons &^ r.buttons
+	r.buttons = buttons &^ (tcell.WheelUp | tcell.WheelDown)
+
+	var button Button
+	switch {
+	case buttons&tcell.WheelUp != 0:
+		button = WheelUp
+	case buttons&tcell.WheelDown != 0:
+		button = WheelDown
+	case pressed&tcell.Button1 != 0:
+		button = ButtonLeft
+	case pressed&tcell.Button2 != 0:
+		button = ButtonRight
+	default:
+		return Event{}, false
+	}
+	x, y := ev.Position()
+	return Event{Type: EventMouse, Button: button, X: x, Y: y}, true
+}
+
+var tcellColors = map[Color]tcell.Color{
+	ColorDefault: tcell.ColorDefault,
+	ColorBlack:   tcell.ColorBlack,
+	ColorRed:     tcell.ColorMaroon,
+	ColorGreen:   tcell.ColorGreen,
+	ColorYellow:  tcell.ColorOlive,
+	ColorBlue:    tcell.ColorNavy,
+	ColorMagenta: tcell.ColorPurple,
+	ColorCyan:    tcell.ColorTeal,
+	ColorWhite:   tcell.ColorSilver,
+	ColorGray:    tcell.ColorGray,
+}
+
+func tcellStyle(style Style) tcell.Style {
+	return tcell.StyleDefault.
+		Foreground(tcellColors[style.Fg]).
+		Background(tcellColors[style.Bg]).
+		Bold(style.Bold).
+		Reverse(style.Reverse)
+}
@@ -0,0 +1,172 @@
+package ui_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/nats-io/nats-top/ui"
+)
+
+func newSimulationRenderer(t *testing.T, width, height int) (tcell.SimulationScreen, *ui.TcellRenderer) {
+	t.Helper()
+
+	screen := tcell.NewSimulationScreen("UTF-8")
+	renderer := ui.NewTcellRenderer(screen)
+	if err := renderer.Init(); err != nil {
+		t.Fatalf("Could not init renderer: %v", err)
+	}
+	t.Cleanup(renderer.Close)
+	screen.SetSize(width, height)
+
+	return screen, renderer
+}
+
+// screenLines returns the text on the screen, without trailing spaces.
+func screenLines(screen tcell.SimulationScreen) []string {
+	cells, width, height := screen.GetContents()
+	lines := make([]string, height)
+	for y := 0; y < height; y++ {
+		var sb strings.Builder
+		for x := 0; x < width; x++ {
+			if runes := cells[y*width+x].Runes; len(runes) > 0 {
+				sb.WriteRune(runes[0])
+			} else {
+				sb.WriteRune(' ')
+			}
+		}
+		lines[y] = strings.TrimRight(sb.String(), " ")
+	}
+	return lines
+}
+
+func TestTcellRendererDraw(t *testing.T) {
+	screen, renderer := newSimulationRenderer(t, 10, 4)
+
+	if width, height := renderer.Size(); width != 10 || height != 4 {
+		t.Fatalf("Unexpected size: %dx%d", width, height)
+	}
+
+	lines := ui.Lines("first\nsecond\nthird line is too long\nfourth\nfifth", ui.Style{})
+	lines[1].Style = ui.Style{Fg: ui.ColorRed, Bold: true}
+	renderer.Draw(&ui.View{Lines: lines})
+
+	got := screenLines(screen)
+	want := []string{"first", "second", "third line", "fourth"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected line %d to be %q, got: %q", i, want[i], got[i])
+		}
+	}
+
+	cells, width, _ := screen.GetContents()
+	fg, _, attrs := cells[width].Style.Decompose()
+	if fg != tcell.ColorMaroon || attrs&tcell.AttrBold == 0 {
+		t.Fatalf("Expected highlighted line, got: %v %v", fg, attrs)
+	}
+
+	// The prompt replaces the line it is drawn over
+	renderer.Draw(&ui.View{Lines: lines, Prompt: "sort by:", PromptRow: 2})
+	if got := screenLines(screen)[2]; got != "sort by:" {
+		t.Fatalf("Expected prompt, got: %q", got)
+	}
+}
+
+func TestTcellRendererDrawTable(t *testing.T) {
+	screen, renderer := newSimulationRenderer(t, 10, 5)
+
+	table := &ui.Table{
+		Header: ui.Line{Text: "CID"},
+		Rows:   ui.Lines("1\n2\n3\n4\n5\n6", ui.Style{}),
+		Cursor: 4,
+	}
+	renderer.Draw(&ui.View{Lines: ui.Lines("header", ui.Style{}), Table: table})
+
+	// The header stays while the rows are scrolled to the cursor
+	got := screenLines(screen)
+	want := []string{"header", "CID", "3", "4", "5"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected line %d to be %q, got: %q", i, want[i], got[i])
+		}
+	}
+	if table.Offset != 2 {
+		t.Fatalf("Expected table to be scrolled to the cursor, got offset: %d", table.Offset)
+	}
+
+	cells, width, _ := screen.GetContents()
+	for x := 0; x < width; x++ {
+		if _, _, attrs := cells[4*width+x].Style.Decompose(); attrs&tcell.AttrReverse == 0 {
+			t.Fatalf("Expected the cursor to span the row, not at column %d", x)
+		}
+	}
+}
+
+func TestTcellRendererDrawSpans(t *testing.T) {
+	screen, renderer := newSimulationRenderer(t, 12, 3)
+
+	red := ui.Style{Fg: ui.ColorRed}
+	line := ui.Line{Text: "a µs 1.2M b", Spans: []ui.Span{{Start: 2, End: 4, Style: red}, {Start: 5, End: 9, Style: red}}}
+	table := &ui.Table{Rows: []ui.Line{line}}
+	renderer.Draw(&ui.View{Lines: []ui.Line{line}, Table: table})
+
+	cells, width, _ := screen.GetContents()
+	// The line is drawn above the header of the table, then in its row
+	for _, y := range []int{0, 2} {
+		for x, ch := range []rune(line.Text) {
+			fg, _, attrs := cells[y*width+x].Style.Decompose()
+			if highlighted := fg == tcell.ColorMaroon; highlighted != (x >= 2 && x < 4 || x >= 5 && x < 9) {
+				t.Fatalf("Unexpected highlight of %q at column %d of line %d: %v", ch, x, y, fg)
+			}
+			// The spans under the cursor are reversed along with the row
+			if reversed := attrs&tcell.AttrReverse != 0; reversed != (y == 2) {
+				t.Fatalf("Unexpected reverse of %q at column %d of line %d", ch, x, y)
+			}
+		}
+	}
+}
+
+func TestTcellRendererEvents(t *testing.T) {
+	screen, renderer := newSimulationRenderer(t, 10, 4)
+
+	screen.InjectKey(tcell.KeyRune, 'o', tcell.ModNone)
+	screen.InjectKey(tcell.KeyBackspace2, 0, tcell.ModNone)
+	screen.InjectKey(tcell.KeyEnter, 0, tcell.ModNone)
+
+	// Only pressing a button or scrolling the wheel are mouse events
+	screen.InjectMouse(3, 2, tcell.Button1, tcell.ModNone)
+	screen.InjectMouse(4, 2, tcell.Button1, tcell.ModNone)
+	screen.InjectMouse(4, 2, tcell.ButtonNone, tcell.ModNone)
+	screen.InjectMouse(5, 1, tcell.WheelDown, tcell.ModNone)
+	screen.InjectMouse(5, 1, tcell.WheelDown, tcell.ModNone)
+	screen.InjectMouse(1, 3, tcell.Button2, tcell.ModNone)
+
+	want := []ui.Event{
+		{Type: ui.EventKey, Key: ui.KeyRune, Ch: 'o'},
+		{Type: ui.EventKey, Key: ui.KeyBackspace},
+		{Type: ui.EventKey, Key: ui.KeyEnter},
+		{Type: ui.EventMouse, Button: ui.ButtonLeft, X: 3, Y: 2},
+		{Type: ui.EventMouse, Button: ui.WheelDown, X: 5, Y: 1},
+		{Type: ui.EventMouse, Button: ui.WheelDown, X: 5, Y: 1},
+		{Type: ui.EventMouse, Button: ui.ButtonRight, X: 1, Y: 3},
+	}
+	for _, w := range want {
+		select {
+		case e := <-renderer.Events():
+			// Skip the resize events of the simulation screen
+			for e.Type == ui.EventResize {
+				e = <-renderer.Events()
+			}
+			if e != w {
+				t.Fatalf("Expected event %+v, got: %+v", w, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %+v", w)
+		}
+	}
+
+	renderer.Close()
+	for range renderer.Events() {
+	}
+}
@@ -0,0 +1,53 @@
+package toputils
+
+import (
+	"math"
+	"time"
+)
+
+// Indexes of the windows used for the moving averages of the rates.
+const (
+	Avg1m = iota
+	Avg5m
+	Avg15m
+)
+
+// AverageWindows are the windows of the moving averages of the rates,
+// the same ones used for the load average by top.
+var AverageWindows = [3]time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// RateAverages represents the exponentially weighted moving averages
+// of the in/out msgs and bytes rates over each of the AverageWindows.
+type RateAverages struct {
+	InMsgsRate   [3]float64
+	OutMsgsRate  [3]float64
+	InBytesRate  [3]float64
+	OutBytesRate [3]float64
+
+	// seeded is set once the averages have taken the first rates.
+	seeded bool
+}
+
+// next returns the averages moved towards the given rates, which were
+// measured over elapsed time. The first rates are taken as they are.
+func (avg RateAverages) next(inMsgs, outMsgs, inBytes, outBytes float64, elapsed time.Duration) RateAverages {
+	if !avg.seeded {
+		for i := range AverageWindows {
+			avg.InMsgsRate[i] = inMsgs
+			avg.OutMsgsRate[i] = outMsgs
+			avg.InBytesRate[i] = inBytes
+			avg.OutBytesRate[i] = outBytes
+		}
+		avg.seeded = true
+		return avg
+	}
+
+	for i, window := range AverageWindows {
+		alpha := 1 - math.Exp(-elapsed.Seconds()/window.Seconds())
+		avg.InMsgsRate[i] += alpha * (inMsgs - avg.InMsgsRate[i])
+		avg.OutMsgsRate[i] += alpha * (outMsgs - avg.OutMsgsRate[i])
+		avg.InBytesRate[i] += alpha * (inBytes - avg.InBytesRate[i])
+		avg.OutBytesRate[i] += alpha * (outBytes - avg.OutBytesRate[i])
+	}
+	return avg
+}
@@ -0,0 +1,64 @@
+package toputils_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestRateAverages(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var inMsgs, connInMsgs int64
+	poll := func(i int, rate int64) *top.Stats {
+		inMsgs += rate * 5
+		connInMsgs += rate
+		fm.update(func(varz *server.Varz, connz *server.Connz) {
+			varz.Now = start.Add(time.Duration(i) * 5 * time.Second)
+			varz.InMsgs = inMsgs
+			connz.Now = varz.Now
+			connz.Conns = []*server.ConnInfo{{Cid: 1, Start: start, InMsgs: connInMsgs * 5}}
+		})
+		return engine.FetchStatsSnapshot()
+	}
+
+	// The first polls only set the baseline and seed the averages
+	stats := poll(0, 100)
+	if stats.Rates.Averages.InMsgsRate != [3]float64{} {
+		t.Fatalf("Expected no averages on first poll, got: %v", stats.Rates.Averages.InMsgsRate)
+	}
+	stats = poll(1, 100)
+	if want := [3]float64{100, 100, 100}; stats.Rates.Averages.InMsgsRate != want {
+		t.Fatalf("Expected averages to be seeded with %v, got: %v", want, stats.Rates.Averages.InMsgsRate)
+	}
+
+	// A steady rate keeps the averages
+	for i := 2; i < 10; i++ {
+		stats = poll(i, 100)
+	}
+	for w, got := range stats.Rates.Averages.InMsgsRate {
+		if math.Abs(got-100) > 0.001 {
+			t.Fatalf("Expected %v average to stay at 100, got: %v", top.AverageWindows[w], got)
+		}
+	}
+
+	// After a minute of a higher rate the shorter windows get closer to it
+	for i := 10; i < 22; i++ {
+		stats = poll(i, 1100)
+	}
+	for _, avg := range []top.RateAverages{stats.Rates.Averages, stats.Rates.Connections[1].Averages} {
+		avg1m, avg5m, avg15m := avg.InMsgsRate[top.Avg1m], avg.InMsgsRate[top.Avg5m], avg.InMsgsRate[top.Avg15m]
+		if !(avg1m > avg5m && avg5m > avg15m && avg15m > 100) {
+			t.Fatalf("Expected averages to decrease with the window, got: %v, %v, %v", avg1m, avg5m, avg15m)
+		}
+
+		// One window of time moves the average about 63% towards the new rate
+		if want := 100 + 1000*(1-math.Exp(-1)); math.Abs(avg1m-want) > 1 {
+			t.Fatalf("Expected 1m average of %v, got: %v", want, avg1m)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package toputils
+
+import (
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// RecentChurnSize is the number of recently connected and
+// disconnected clients that are kept.
+const RecentChurnSize = 5
+
+// ConnEvent represents a client that connected or disconnected.
+type ConnEvent struct {
+	Time time.Time
+	Cid  uint64
+	Name string
+	IP   string
+	Port int
+}
+
+// Churn represents the connections that came and went between two polls.
+type Churn struct {
+	New  int
+	Gone int
+
+	// Rate is the number of new and gone connections per second.
+	Rate float64
+
+	// Partial is set when not all the connections were polled, in which
+	// case connections falling out of the sample are counted as gone.
+	Partial bool
+
+	// Connected and Disconnected are the most recent clients
+	// that connected and disconnected, newest first.
+	Connected    []ConnEvent
+	Disconnected []ConnEvent
+}
+
+func newConnEvent(t time.Time, conn *server.ConnInfo) ConnEvent {
+	return ConnEvent{Time: t, Cid: conn.Cid, Name: conn.Name, IP: conn.IP, Port: conn.Port}
+}
+
+// pushEvent prepends an event to a list keeping at most RecentChurnSize of them.
+func pushEvent(events []ConnEvent, event ConnEvent) []ConnEvent {
+	events = append([]ConnEvent{event}, events...)
+	if len(events) > RecentChurnSize {
+		events = events[:RecentChurnSize]
+	}
+	return events
+}
+
+// trackChurn compares the CIDs of the polled connections with the ones of
+// the previous poll and records which connections are new and which are gone.
+func (engine *Engine) trackChurn(connz *server.Connz, conns map[uint64]*server.ConnInfo, elapsed time.Duration) *Churn {
+	churn := &Churn{Partial: connz.Total > len(connz.Conns)}
+
+	for _, conn := range connz.Conns {
+		if _, ok := engine.LastConnz[conn.Cid]; !ok {
+			churn.New++
+			engine.recentConnected = pushEvent(engine.recentConnected, newConnEvent(conn.Start, conn))
+		}
+	}
+	for cid, lconn := range engine.LastConnz {
+		if _, ok := conns[cid]; !ok {
+			churn.Gone++
+			engine.recentDisconnected = pushEvent(engine.recentDisconnected, newConnEvent(connz.Now, lconn))
+		}
+	}
+
+	if elapsed > 0 {
+		churn.Rate = float64(churn.New+churn.Gone) / elapsed.Seconds()
+	}
+	churn.Connected = append([]ConnEvent(nil), engine.recentConnected...)
+	churn.Disconnected = append([]ConnEvent(nil), engine.recentDisconnected...)
+
+	return churn
+}
@@ -0,0 +1,81 @@
+package toputils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+func TestConnectionChurn(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		varz.Now, connz.Now = start, start
+		connz.Conns = []*server.ConnInfo{
+			{Cid: 1, Start: start, Name: "a", IP: "10.0.0.1", Port: 1001},
+			{Cid: 2, Start: start, Name: "b", IP: "10.0.0.2", Port: 1002},
+		}
+		connz.Total = 2
+	})
+	stats := engine.FetchStatsSnapshot()
+	if stats.Churn != nil {
+		t.Fatalf("Expected no churn on the first poll, got: %+v", stats.Churn)
+	}
+
+	now := start.Add(2 * time.Second)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		varz.Now, connz.Now = now, now
+		connz.Conns = []*server.ConnInfo{
+			{Cid: 2, Start: start, Name: "b", IP: "10.0.0.2", Port: 1002},
+			{Cid: 3, Start: start.Add(time.Second), Name: "c", IP: "10.0.0.3", Port: 1003},
+			{Cid: 4, Start: start.Add(1500 * time.Millisecond), Name: "d", IP: "10.0.0.4", Port: 1004},
+		}
+		connz.Total = 3
+	})
+	stats = engine.FetchStatsSnapshot()
+
+	churn := stats.Churn
+	if churn == nil {
+		t.Fatal("Expected churn")
+	}
+	if churn.New != 2 || churn.Gone != 1 {
+		t.Fatalf("Expected 2 new and 1 gone connections, got: +%d -%d", churn.New, churn.Gone)
+	}
+	if churn.Rate != 1.5 {
+		t.Fatalf("Expected churn rate of 1.5/sec, got: %v", churn.Rate)
+	}
+	if churn.Partial {
+		t.Fatal("Expected churn over all the connections")
+	}
+	if len(churn.Connected) != 2 || churn.Connected[0].Cid != 4 || churn.Connected[1].Cid != 3 {
+		t.Fatalf("Expected recently connected clients newest first, got: %+v", churn.Connected)
+	}
+	if !churn.Connected[0].Time.Equal(start.Add(1500 * time.Millisecond)) {
+		t.Fatalf("Expected connect time from the connection start, got: %v", churn.Connected[0].Time)
+	}
+	if len(churn.Disconnected) != 1 {
+		t.Fatalf("Expected 1 recently disconnected client, got: %+v", churn.Disconnected)
+	}
+	if gone := churn.Disconnected[0]; gone.Cid != 1 || gone.Name != "a" || gone.IP != "10.0.0.1" || !gone.Time.Equal(now) {
+		t.Fatalf("Unexpected disconnected client: %+v", gone)
+	}
+
+	// Recent clients are kept across polls without churn
+	now = now.Add(time.Second)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		varz.Now, connz.Now = now, now
+		connz.Total = 10
+	})
+	churn = engine.FetchStatsSnapshot().Churn
+	if churn.New != 0 || churn.Gone != 0 || churn.Rate != 0 {
+		t.Fatalf("Expected no churn, got: %+v", churn)
+	}
+	if !churn.Partial {
+		t.Fatal("Expected churn to be partial when not all connections are polled")
+	}
+	if len(churn.Connected) != 2 || len(churn.Disconnected) != 1 {
+		t.Fatalf("Expected recent clients to be kept, got: %+v", churn)
+	}
+}
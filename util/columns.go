@@ -0,0 +1,119 @@
+package toputils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// DefaultColumns are the columns of the connections table displayed
+// unless others are chosen.
+var DefaultColumns = []Column{
+	ColumnHost, ColumnCid, ColumnName, ColumnSubs, ColumnPending,
+	ColumnMsgsTo, ColumnMsgsFrom, ColumnBytesTo, ColumnBytesFrom,
+	ColumnRTT, ColumnLang, ColumnVersion, ColumnUptime, ColumnLast,
+}
+
+// ParseColumns returns the columns of a comma separated list, e.g.
+// "host,cid,account", which replaces the given ones, or else the given
+// ones with those in the list prefixed by + shown at the end and those
+// prefixed by - hidden, e.g. "+account,-rtt".
+func ParseColumns(list string, columns []Column) ([]Column, error) {
+	var parsed []Column
+	relative := false
+	for i, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		prefixed := strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-")
+		if i == 0 {
+			relative = prefixed
+			if relative {
+				parsed = slices.Clone(columns)
+			}
+		}
+		if prefixed != relative {
+			return nil, fmt.Errorf("columns must either all or none have a + or - prefix: %s", list)
+		}
+
+		column := Column(strings.TrimLeft(name, "+-"))
+		if column == ColumnNone || !column.IsValid() {
+			return nil, fmt.Errorf("invalid column: %s", name)
+		}
+
+		switch {
+		case strings.HasPrefix(name, "-"):
+			parsed = slices.DeleteFunc(parsed, func(c Column) bool { return c == column })
+		case slices.Contains(parsed, column):
+			if !relative {
+				return nil, fmt.Errorf("duplicate column: %s", name)
+			}
+		default:
+			parsed = append(parsed, column)
+		}
+	}
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("no columns to display: %s", list)
+	}
+	return parsed, nil
+}
+
+// FormatColumns returns the comma separated list of the columns.
+func FormatColumns(columns []Column) string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = string(column)
+	}
+	return strings.Join(names, ",")
+}
+
+// MoveColumn returns the columns with the given one moved by offset
+// places, towards the first one if negative, within the bounds.
+func MoveColumn(columns []Column, column Column, offset int) []Column {
+	i := slices.Index(columns, column)
+	if i < 0 {
+		return columns
+	}
+	j := min(max(i+offset, 0), len(columns)-1)
+
+	moved := slices.Delete(slices.Clone(columns), i, i+1)
+	return slices.Insert(moved, j, column)
+}
+
+// LoadColumns reads the columns saved in a file by SaveColumns.
+func LoadColumns(path string) ([]Column, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseColumns(strings.TrimSpace(string(data)), nil)
+}
+
+// SaveColumns writes the columns to a file, so that the same ones are
+// displayed the next time.
+func SaveColumns(path string, columns []Column) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(FormatColumns(columns)+"\n"), 0o644)
+}
+
+// SetAccounts makes the engine request the accounts of the connections,
+// or stops doing so if they are not displayed.
+func (engine *Engine) SetAccounts(displayed bool) {
+	if engine.accounts.Swap(displayed) == displayed {
+		return
+	}
+	engine.requestPoll()
+}
+
+// ConnAccount returns the account of a connection, which is only known
+// by its name tag for the global account.
+func ConnAccount(conn *server.ConnInfo) string {
+	if conn.Account != "" {
+		return conn.Account
+	}
+	return conn.NameTag
+}
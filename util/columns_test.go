@@ -0,0 +1,150 @@
+package toputils_test
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestParseColumns(t *testing.T) {
+	current := []top.Column{top.ColumnHost, top.ColumnCid, top.ColumnRTT}
+
+	for list, want := range map[string][]top.Column{
+		"cid,account,tls":   {top.ColumnCid, top.ColumnAccount, top.ColumnTLS},
+		"KIND, Host":        {top.ColumnKind, top.ColumnHost},
+		"+account":          {top.ColumnHost, top.ColumnCid, top.ColumnRTT, top.ColumnAccount},
+		"-rtt,+kind,-host":  {top.ColumnCid, top.ColumnKind},
+		"+cid":              {top.ColumnHost, top.ColumnCid, top.ColumnRTT},
+		"-account":          {top.ColumnHost, top.ColumnCid, top.ColumnRTT},
+		"rtt,last,subs,cid": {top.ColumnRTT, top.ColumnLast, top.ColumnSubs, top.ColumnCid},
+	} {
+		got, err := top.ParseColumns(list, current)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %q: %v", list, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("Expected %q to be parsed as %v, got: %v", list, want, got)
+		}
+	}
+
+	for _, list := range []string{"", "foo", "cid,cid", "cid,+rtt", "+rtt,cid", "-host,-cid,-rtt"} {
+		if _, err := top.ParseColumns(list, current); err == nil {
+			t.Fatalf("Expected an error parsing %q", list)
+		}
+	}
+	if !slices.Equal(current, []top.Column{top.ColumnHost, top.ColumnCid, top.ColumnRTT}) {
+		t.Fatalf("Expected the current columns to be left as they were, got: %v", current)
+	}
+}
+
+func TestMoveColumn(t *testing.T) {
+	columns := []top.Column{top.ColumnHost, top.ColumnCid, top.ColumnName, top.ColumnRTT}
+
+	for _, test := range []struct {
+		column top.Column
+		offset int
+		want   []top.Column
+	}{
+		{top.ColumnName, -1, []top.Column{top.ColumnHost, top.ColumnName, top.ColumnCid, top.ColumnRTT}},
+		{top.ColumnHost, 2, []top.Column{top.ColumnCid, top.ColumnName, top.ColumnHost, top.ColumnRTT}},
+		{top.ColumnHost, -1, columns},
+		{top.ColumnCid, 10, []top.Column{top.ColumnHost, top.ColumnName, top.ColumnRTT, top.ColumnCid}},
+		{top.ColumnTLS, 1, columns},
+	} {
+		if got := top.MoveColumn(columns, test.column, test.offset); !slices.Equal(got, test.want) {
+			t.Fatalf("Expected moving %s by %d to give %v, got: %v", test.column, test.offset, test.want, got)
+		}
+	}
+}
+
+func TestSaveColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nats-top", "columns")
+	if _, err := top.LoadColumns(path); err == nil {
+		t.Fatal("Expected an error loading columns that were never saved")
+	}
+
+	columns := []top.Column{top.ColumnCid, top.ColumnAccount, top.ColumnKind, top.ColumnTLS}
+	if err := top.SaveColumns(path, columns); err != nil {
+		t.Fatalf("Unexpected error saving columns: %v", err)
+	}
+	got, err := top.LoadColumns(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading columns: %v", err)
+	}
+	if !slices.Equal(got, columns) {
+		t.Fatalf("Expected the saved columns %v, got: %v", columns, got)
+	}
+}
+
+func TestConnAccount(t *testing.T) {
+	if got := top.ConnAccount(&server.ConnInfo{Account: "SALES", NameTag: "sales"}); got != "SALES" {
+		t.Fatalf("Expected the account, got: %q", got)
+	}
+	if got := top.ConnAccount(&server.ConnInfo{NameTag: "$G"}); got != "$G" {
+		t.Fatalf("Expected the global account by its name tag, got: %q", got)
+	}
+}
+
+func TestSetAccounts(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		connz.Conns = []*server.ConnInfo{{Cid: 1, Account: "A", JWT: "jwt", IssuerKey: "issuer"}}
+	})
+
+	var query string
+	fm.Lock()
+	fm.onRequest = func(q string) {
+		// The detail of a followed connection is always requested with auth
+		if !strings.Contains(q, "cid=") {
+			query = q
+		}
+	}
+	fm.Unlock()
+
+	for _, tc := range []struct {
+		name     string
+		accounts bool
+		filter   *top.ConnFilter
+		follow   uint64
+		auth     bool
+	}{
+		{"none", false, nil, 0, false},
+		{"accounts", true, nil, 0, true},
+		{"filter", false, top.NewConnFilter("A"), 0, true},
+		{"followed", false, nil, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			engine.SetAccounts(tc.accounts)
+			engine.SetFilter(tc.filter)
+			engine.FollowConn(tc.follow)
+
+			stats := engine.FetchStatsSnapshot()
+			fm.Lock()
+			auth := strings.Contains(query, "auth=true")
+			fm.Unlock()
+			if auth != tc.auth {
+				t.Fatalf("Expected auth requested to be %v, got query: %q", tc.auth, query)
+			}
+
+			// The credentials are never kept in the snapshot
+			conn := stats.Connz.Conns[0]
+			if conn.JWT != "" || conn.IssuerKey != "" {
+				t.Fatalf("Expected the JWT and issuer key to be cleared, got: %+v", conn)
+			}
+
+			// The issuer key of the followed connection is displayed in its detail
+			if tc.follow != 0 {
+				if stats.Detail == nil || stats.Detail.Conn == nil {
+					t.Fatalf("Expected the detail of connection %d, got: %+v", tc.follow, stats.Detail)
+				}
+				if detail := stats.Detail.Conn; detail.JWT != "" || detail.IssuerKey != "issuer" {
+					t.Fatalf("Expected only the JWT of the detail to be cleared, got: %+v", detail)
+				}
+			}
+		})
+	}
+}
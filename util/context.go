@@ -0,0 +1,130 @@
+package toputils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// NATSContext holds the settings of a `nats` CLI context that are
+// relevant for polling the monitoring endpoint of a server.
+type NATSContext struct {
+	Name        string `json:"-"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Cert        string `json:"cert"`
+	Key         string `json:"key"`
+	CA          string `json:"ca"`
+	TLSFirst    bool   `json:"tls_first"`
+}
+
+// natsConfigDir returns the directory where the `nats` CLI
+// keeps its configuration.
+func natsConfigDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "nats"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "nats"), nil
+}
+
+// LoadNATSContext reads a `nats` CLI context by name from the standard
+// config directory. A name ending in .json is read as a path instead, and
+// an empty name loads the currently selected context.
+func LoadNATSContext(name string) (*NATSContext, error) {
+	var path string
+
+	if strings.HasSuffix(name, ".json") {
+		path = expandHome(name)
+	} else {
+		dir, err := natsConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not find nats config directory: %w", err)
+		}
+
+		if name == "" {
+			selected, err := os.ReadFile(filepath.Join(dir, "context.txt"))
+			if err != nil {
+				return nil, fmt.Errorf("no nats context selected: %w", err)
+			}
+			name = strings.TrimSpace(string(selected))
+		}
+
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("invalid nats context name %q", name)
+		}
+		path = filepath.Join(dir, "context", name+".json")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read nats context: %w", err)
+	}
+
+	nctx := &NATSContext{}
+	if err := json.Unmarshal(data, nctx); err != nil {
+		return nil, fmt.Errorf("could not parse nats context %q: %w", path, err)
+	}
+	nctx.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	nctx.Cert = expandHome(nctx.Cert)
+	nctx.Key = expandHome(nctx.Key)
+	nctx.CA = expandHome(nctx.CA)
+
+	return nctx, nil
+}
+
+// MonitoringHost returns the host of the first server in the context URL,
+// which is where the monitoring endpoint is expected to be listening.
+func (nctx *NATSContext) MonitoringHost() (string, error) {
+	first := strings.TrimSpace(strings.Split(nctx.URL, ",")[0])
+	if first == "" {
+		return "", fmt.Errorf("nats context %q has no server url", nctx.Name)
+	}
+	if !strings.Contains(first, "://") {
+		first = "nats://" + first
+	}
+
+	u, err := url.Parse(first)
+	if err != nil {
+		return "", fmt.Errorf("invalid server url in nats context %q: %w", nctx.Name, err)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return "", fmt.Errorf("invalid server url in nats context %q: %s", nctx.Name, first)
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		host = "[" + host + "]"
+	}
+
+	return host, nil
+}
+
+// UseTLS reports whether the context has a CA or a client certificate,
+// in which case the monitoring endpoint is polled via HTTPS with them.
+// A tls:// URL alone doesn't tell, as the monitoring endpoint is often
+// served via plain HTTP even when clients connect using TLS.
+func (nctx *NATSContext) UseTLS() bool {
+	return nctx.CA != "" || nctx.Cert != ""
+}
+
+// expandHome replaces a leading ~ in path with the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,97 @@
+package toputils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	top "github.com/nats-io/nats-top/util"
+)
+
+func writeNATSContext(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	ctxDir := filepath.Join(dir, "nats", "context")
+	if err := os.MkdirAll(ctxDir, 0700); err != nil {
+		t.Fatalf("Could not create context directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(ctxDir, name+".json"), []byte(content), 0600); err != nil {
+		t.Fatalf("Could not write context: %v", err)
+	}
+}
+
+func TestLoadNATSContext(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	writeNATSContext(t, dir, "prod", `{
+		"description": "production",
+		"url": "tls://nats1.example.com:4222,tls://nats2.example.com:4222",
+		"ca": "/etc/nats/ca.pem",
+		"cert": "/etc/nats/cert.pem",
+		"key": "/etc/nats/key.pem"
+	}`)
+	writeNATSContext(t, dir, "local", `{"url": "nats://[::1]:4222"}`)
+	writeNATSContext(t, dir, "public", `{"url": "tls://demo.example.com:4222", "tls_first": true}`)
+
+	nctx, err := top.LoadNATSContext("prod")
+	if err != nil {
+		t.Fatalf("Expected to load context, got: %v", err)
+	}
+	if nctx.CA != "/etc/nats/ca.pem" || nctx.Cert != "/etc/nats/cert.pem" || nctx.Key != "/etc/nats/key.pem" {
+		t.Fatalf("Unexpected TLS settings: %+v", nctx)
+	}
+	if !nctx.UseTLS() {
+		t.Fatal("Expected context to use TLS")
+	}
+	host, err := nctx.MonitoringHost()
+	if err != nil {
+		t.Fatalf("Expected monitoring host, got: %v", err)
+	}
+	if host != "nats1.example.com" {
+		t.Fatalf("Expected host of the first server, got: %q", host)
+	}
+
+	nctx, err = top.LoadNATSContext("local")
+	if err != nil {
+		t.Fatalf("Expected to load context, got: %v", err)
+	}
+	if nctx.UseTLS() {
+		t.Fatal("Expected context without TLS")
+	}
+	host, err = nctx.MonitoringHost()
+	if err != nil {
+		t.Fatalf("Expected monitoring host, got: %v", err)
+	}
+	if host != "[::1]" {
+		t.Fatalf("Expected bracketed IPv6 host, got: %q", host)
+	}
+
+	// Connecting with TLS doesn't make the monitoring endpoint use it
+	nctx, err = top.LoadNATSContext("public")
+	if err != nil {
+		t.Fatalf("Expected to load context, got: %v", err)
+	}
+	if nctx.UseTLS() {
+		t.Fatal("Expected context without TLS settings to poll via http")
+	}
+
+	// The selected context is used when no name is given
+	if err := os.WriteFile(filepath.Join(dir, "nats", "context.txt"), []byte("local\n"), 0600); err != nil {
+		t.Fatalf("Could not select context: %v", err)
+	}
+	nctx, err = top.LoadNATSContext("")
+	if err != nil {
+		t.Fatalf("Expected to load selected context, got: %v", err)
+	}
+	if nctx.Name != "local" {
+		t.Fatalf("Expected selected context, got: %q", nctx.Name)
+	}
+
+	if _, err := top.LoadNATSContext("missing"); err == nil {
+		t.Fatal("Expected error loading missing context")
+	}
+	if _, err := top.LoadNATSContext("../prod"); err == nil {
+		t.Fatal("Expected error for context name with path separators")
+	}
+}
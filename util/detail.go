@@ -0,0 +1,60 @@
+package toputils
+
+import (
+	"fmt"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// ConnDetail is the full information of the connection followed by the
+// engine, requested with its subscriptions and authentication details.
+type ConnDetail struct {
+	Cid uint64
+
+	// Conn is nil if the request failed or the connection is not known
+	// by the server anymore. A closed connection has its Stop time set.
+	Conn  *server.ConnInfo
+	Error error
+}
+
+// FollowConn makes the engine request the detail of the connection with
+// the given CID on every poll, or stops doing so if it is zero.
+func (engine *Engine) FollowConn(cid uint64) {
+	if engine.detailCid.Swap(cid) == cid || cid == 0 {
+		return
+	}
+	engine.requestPoll()
+}
+
+// FollowedConn returns the CID of the connection followed by the engine.
+func (engine *Engine) FollowedConn() uint64 {
+	return engine.detailCid.Load()
+}
+
+// RequestConn returns the detail of a single connection, either open or
+// recently closed, using /connz?cid=N with its subscriptions detail.
+func (engine *Engine) RequestConn(cid uint64) *ConnDetail {
+	detail := &ConnDetail{Cid: cid}
+
+	uri := engine.Uri + fmt.Sprintf("/connz?cid=%d&state=all&subs=detail&auth=true", cid)
+	status, body, err := engine.get(uri)
+	if err != nil {
+		detail.Error = err
+		return detail
+	}
+
+	connz := &server.Connz{}
+	if err := decodeStatz(status, body, connz); err != nil {
+		detail.Error = err
+		return detail
+	}
+	for _, conn := range connz.Conns {
+		if conn.Cid == cid {
+			detail.Conn = conn
+		}
+	}
+	if detail.Conn == nil {
+		detail.Error = fmt.Errorf("connection %d not found", cid)
+	}
+	return detail
+}
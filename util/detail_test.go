@@ -0,0 +1,75 @@
+package toputils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+func TestFollowConn(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		connz.Conns = []*server.ConnInfo{
+			{Cid: 1, Name: "first"},
+			{Cid: 2, Name: "second", Account: "A", SubsDetail: []server.SubDetail{{Subject: "foo", Sid: "1"}}},
+		}
+	})
+
+	stats := engine.FetchStatsSnapshot()
+	if stats.Detail != nil {
+		t.Fatalf("Expected no detail without a followed connection, got: %+v", stats.Detail)
+	}
+
+	engine.FollowConn(2)
+	stats = engine.FetchStatsSnapshot()
+	if stats.Detail == nil || stats.Detail.Error != nil {
+		t.Fatalf("Expected detail of connection 2, got: %+v", stats.Detail)
+	}
+	conn := stats.Detail.Conn
+	if conn.Cid != 2 || conn.Name != "second" || conn.Account != "A" {
+		t.Fatalf("Unexpected connection detail: %+v", conn)
+	}
+	if len(conn.SubsDetail) != 1 || conn.SubsDetail[0].Subject != "foo" {
+		t.Fatalf("Expected subscriptions detail, got: %+v", conn.SubsDetail)
+	}
+	if len(stats.Connz.Conns) != 2 {
+		t.Fatalf("Expected the connections to still be polled, got: %d", len(stats.Connz.Conns))
+	}
+
+	engine.FollowConn(3)
+	stats = engine.FetchStatsSnapshot()
+	if stats.Detail == nil || stats.Detail.Conn != nil || stats.Detail.Error == nil {
+		t.Fatalf("Expected an error for an unknown connection, got: %+v", stats.Detail)
+	}
+	if stats.Stale {
+		t.Fatal("Expected the poll to succeed")
+	}
+
+	engine.FollowConn(0)
+	if stats = engine.FetchStatsSnapshot(); stats.Detail != nil {
+		t.Fatalf("Expected no detail after unfollowing, got: %+v", stats.Detail)
+	}
+}
+
+func TestFollowConnWhileMonitoring(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		connz.Conns = []*server.ConnInfo{{Cid: 1, Name: "first"}}
+	})
+
+	engine.Delay = 3600
+	runMonitorStats(t, engine)
+	<-engine.StatsCh
+
+	// The detail is polled right away instead of on the next refresh
+	engine.FollowConn(1)
+	select {
+	case stats := <-engine.StatsCh:
+		if stats.Detail == nil || stats.Detail.Conn == nil || stats.Detail.Conn.Name != "first" {
+			t.Fatalf("Expected detail of connection 1, got: %+v", stats.Detail)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the detail of the followed connection")
+	}
+}
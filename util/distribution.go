@@ -0,0 +1,76 @@
+package toputils
+
+import (
+	"math"
+	"sort"
+)
+
+// Distribution summarizes how a value is spread across connections.
+type Distribution struct {
+	Min    float64
+	Median float64
+	P90    float64
+	P99    float64
+	Max    float64
+}
+
+// NewDistribution computes the distribution of the given values
+// using the nearest-rank method for the percentiles.
+func NewDistribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+		return sorted[rank-1]
+	}
+
+	return Distribution{
+		Min:    sorted[0],
+		Median: percentile(50),
+		P90:    percentile(90),
+		P99:    percentile(99),
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+// ConnsDistribution represents the distribution of pending bytes, msgs
+// per second (sent and received) and subscriptions across the polled connections.
+type ConnsDistribution struct {
+	Pending  Distribution
+	MsgsRate Distribution
+	NumSubs  Distribution
+}
+
+// NewConnsDistribution computes the distributions for the connections of a snapshot.
+func NewConnsDistribution(stats *Stats) ConnsDistribution {
+	conns := stats.Connz.Conns
+
+	pending := make([]float64, 0, len(conns))
+	msgsRate := make([]float64, 0, len(conns))
+	numSubs := make([]float64, 0, len(conns))
+	for _, conn := range conns {
+		pending = append(pending, float64(conn.Pending))
+		numSubs = append(numSubs, float64(conn.NumSubs))
+
+		var rate float64
+		if crate, ok := stats.Rates.Connections[conn.Cid]; ok {
+			rate = crate.InMsgsRate + crate.OutMsgsRate
+		}
+		msgsRate = append(msgsRate, rate)
+	}
+
+	return ConnsDistribution{
+		Pending:  NewDistribution(pending),
+		MsgsRate: NewDistribution(msgsRate),
+		NumSubs:  NewDistribution(numSubs),
+	}
+}
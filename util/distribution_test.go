@@ -0,0 +1,74 @@
+package toputils_test
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestDistribution(t *testing.T) {
+	testcases := map[string]struct {
+		values []float64
+		want   top.Distribution
+	}{
+		"given no values": {
+			values: nil,
+			want:   top.Distribution{},
+		},
+		"given a single value": {
+			values: []float64{7},
+			want:   top.Distribution{Min: 7, Median: 7, P90: 7, P99: 7, Max: 7},
+		},
+		"given unsorted values": {
+			values: []float64{5, 1, 4, 2, 3},
+			want:   top.Distribution{Min: 1, Median: 3, P90: 5, P99: 5, Max: 5},
+		},
+		"given one outlier in a hundred values": {
+			values: func() []float64 {
+				values := make([]float64, 100)
+				for i := range values {
+					values[i] = float64(i % 10)
+				}
+				values[42] = 1000
+				return values
+			}(),
+			want: top.Distribution{Min: 0, Median: 5, P90: 9, P99: 9, Max: 1000},
+		},
+	}
+
+	for name, testcase := range testcases {
+		t.Run(name, func(t *testing.T) {
+			got := top.NewDistribution(testcase.values)
+
+			if got != testcase.want {
+				t.Errorf("wanted %+v, got %+v", testcase.want, got)
+			}
+		})
+	}
+}
+
+func TestConnsDistribution(t *testing.T) {
+	stats := &top.Stats{
+		Connz: &server.Connz{Conns: []*server.ConnInfo{
+			{Cid: 1, Pending: 100, NumSubs: 1},
+			{Cid: 2, Pending: 0, NumSubs: 10},
+			{Cid: 3, Pending: 5000, NumSubs: 3},
+		}},
+		Rates: &top.Rates{Connections: map[uint64]*top.ConnRates{
+			1: {InMsgsRate: 10, OutMsgsRate: 5},
+			2: {InMsgsRate: 1},
+		}},
+	}
+
+	dist := top.NewConnsDistribution(stats)
+	if want := (top.Distribution{Min: 0, Median: 100, P90: 5000, P99: 5000, Max: 5000}); dist.Pending != want {
+		t.Errorf("Expected pending distribution %+v, got %+v", want, dist.Pending)
+	}
+	if want := (top.Distribution{Min: 0, Median: 1, P90: 15, P99: 15, Max: 15}); dist.MsgsRate != want {
+		t.Errorf("Expected msgs rate distribution %+v, got %+v", want, dist.MsgsRate)
+	}
+	if want := (top.Distribution{Min: 1, Median: 3, P90: 10, P99: 10, Max: 10}); dist.NumSubs != want {
+		t.Errorf("Expected subscriptions distribution %+v, got %+v", want, dist.NumSubs)
+	}
+}
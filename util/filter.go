@@ -0,0 +1,80 @@
+package toputils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// ConnFilter matches the connections with a host, name, account,
+// lang/version or subscription matching a pattern, ignoring case.
+type ConnFilter struct {
+	Pattern string
+
+	re *regexp.Regexp
+}
+
+// NewConnFilter returns a filter for a pattern, which matches the fields
+// containing it as it is or, if it is a valid regular expression, the
+// ones matching it, e.g. "$G" or "^orders-".
+func NewConnFilter(pattern string) *ConnFilter {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		re = nil
+	}
+	return &ConnFilter{Pattern: pattern, re: re}
+}
+
+// Match reports whether the connection matches the filter.
+func (f *ConnFilter) Match(conn *server.ConnInfo) bool {
+	fields := []string{
+		fmt.Sprintf("%s:%d", conn.IP, conn.Port),
+		conn.Name,
+		conn.Account,
+		conn.NameTag,
+		strings.TrimSpace(conn.Lang + " " + conn.Version),
+	}
+	fields = append(fields, conn.Subs...)
+
+	for _, field := range fields {
+		if field == "" {
+			continue
+		}
+		if strings.Contains(strings.ToLower(field), strings.ToLower(f.Pattern)) {
+			return true
+		}
+		if f.re != nil && f.re.MatchString(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFilter filters the displayed connections, or stops if it is nil.
+func (engine *Engine) SetFilter(filter *ConnFilter) {
+	engine.filter.Store(filter)
+	engine.requestPoll()
+}
+
+// Filter returns the filter of the displayed connections, or nil.
+func (engine *Engine) Filter() *ConnFilter {
+	return engine.filter.Load()
+}
+
+// Filter returns a copy of a snapshot with only the connections
+// matching the filter.
+func (f *ConnFilter) Filter(stats *Stats) *Stats {
+	connz := *stats.Connz
+	connz.Conns = nil
+	for _, conn := range stats.Connz.Conns {
+		if f.Match(conn) {
+			connz.Conns = append(connz.Conns, conn)
+		}
+	}
+
+	filtered := *stats
+	filtered.Connz = &connz
+	return &filtered
+}
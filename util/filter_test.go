@@ -0,0 +1,126 @@
+package toputils_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestConnFilter(t *testing.T) {
+	conns := []*server.ConnInfo{
+		{Cid: 1, IP: "10.0.0.1", Port: 4000, Name: "orders-api", Lang: "go", Version: "1.30.0", Account: "SALES"},
+		{Cid: 2, IP: "10.0.0.2", Port: 5000, Name: "billing", Lang: "python3", Version: "2.6.0", Subs: []string{"invoices.>", "_INBOX.abc"}},
+		{Cid: 3, IP: "192.168.1.7", Port: 6000, Lang: "java", Version: "2.17.1", NameTag: "$G"},
+	}
+
+	for _, test := range []struct {
+		pattern string
+		want    []uint64
+	}{
+		{"orders", []uint64{1}},
+		{"ORDERS", []uint64{1}},
+		{"sales", []uint64{1}},
+		{"invoices", []uint64{2}},
+		{"python3 2.6", []uint64{2}},
+		{"192.168.", []uint64{3}},
+		{":5000", []uint64{2}},
+		{"$G", []uint64{3}},
+		{"^(orders|billing)", []uint64{1, 2}},
+		{"2\\.\\d+\\.", []uint64{2, 3}},
+		{"invoices.>(", nil},
+		{"_INBOX.", []uint64{2}},
+		{"nothing", nil},
+	} {
+		filter := top.NewConnFilter(test.pattern)
+
+		var got []uint64
+		for _, conn := range conns {
+			if filter.Match(conn) {
+				got = append(got, conn.Cid)
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("Expected %q to match %v, got: %v", test.pattern, test.want, got)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("Expected %q to match %v, got: %v", test.pattern, test.want, got)
+			}
+		}
+	}
+}
+
+func TestConnFilterStats(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		connz.NumConns = 2
+		connz.Conns = []*server.ConnInfo{
+			{Cid: 1, Name: "orders"},
+			{Cid: 2, Name: "billing"},
+		}
+	})
+
+	stats := engine.FetchStatsSnapshot()
+	filtered := top.NewConnFilter("bill").Filter(stats)
+	if len(filtered.Connz.Conns) != 1 || filtered.Connz.Conns[0].Cid != 2 {
+		t.Fatalf("Expected only connection 2, got: %+v", filtered.Connz.Conns)
+	}
+	if filtered.Connz.NumConns != 2 || len(stats.Connz.Conns) != 2 {
+		t.Fatal("Expected the snapshot to be left as it was")
+	}
+	if filtered.Rates != stats.Rates {
+		t.Fatal("Expected the rates of the snapshot to be kept")
+	}
+
+	// Subscriptions are requested while filtering to match them too
+	var query string
+	fm.Lock()
+	fm.onRequest = func(q string) { query = q }
+	fm.Unlock()
+
+	engine.SetFilter(top.NewConnFilter("foo"))
+	engine.FetchStatsSnapshot()
+	if !strings.Contains(query, "subs=1") {
+		t.Fatalf("Expected subscriptions to be requested, got: %q", query)
+	}
+}
+
+func TestSetFilterWhileMonitoring(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		connz.Conns = []*server.ConnInfo{{Cid: 1, Name: "foo"}, {Cid: 2, Name: "bar"}}
+	})
+
+	var queries []string
+	fm.Lock()
+	fm.onRequest = func(q string) { queries = append(queries, q) }
+	fm.Unlock()
+
+	// The filter is changed from this goroutine, as the UI does,
+	// while the engine polls, with a poll right away on every change.
+	engine.Delay = 3600
+	runMonitorStats(t, engine)
+	for i := 0; i < 10; i++ {
+		var filter *top.ConnFilter
+		if i%2 == 0 {
+			filter = top.NewConnFilter("foo")
+		}
+		engine.SetFilter(filter)
+
+		select {
+		case <-engine.StatsCh:
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for a poll after the filter changed")
+		}
+	}
+
+	fm.Lock()
+	defer fm.Unlock()
+	if len(queries) < 2 || !slices.ContainsFunc(queries, func(q string) bool { return strings.Contains(q, "subs=1") }) {
+		t.Fatalf("Expected subscriptions to be requested while filtering, got: %q", queries)
+	}
+}
@@ -0,0 +1,110 @@
+package toputils
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// GroupBy is the field used for aggregating connections.
+type GroupBy string
+
+const (
+	GroupByNone    GroupBy = ""
+	GroupByName    GroupBy = "name"
+	GroupByIP      GroupBy = "ip"
+	GroupByAccount GroupBy = "account"
+	GroupByLang    GroupBy = "lang"
+)
+
+// GroupByOptions are the valid fields for aggregating connections, in
+// the order they are cycled through.
+var GroupByOptions = []GroupBy{GroupByNone, GroupByName, GroupByIP, GroupByAccount, GroupByLang}
+
+// IsValid determines if a group by option is valid.
+func (g GroupBy) IsValid() bool {
+	for _, opt := range GroupByOptions {
+		if g == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the value of the field for a connection.
+func (g GroupBy) Key(conn *server.ConnInfo) string {
+	switch g {
+	case GroupByName:
+		return conn.Name
+	case GroupByIP:
+		return conn.IP
+	case GroupByAccount:
+		return ConnAccount(conn)
+	case GroupByLang:
+		return strings.TrimSpace(conn.Lang + " " + conn.Version)
+	}
+	return ""
+}
+
+// Group represents the totals and rates of the connections
+// sharing the same value of the grouped by field.
+type Group struct {
+	Key      string
+	Conns    int
+	NumSubs  uint32
+	Pending  int
+	InMsgs   int64
+	OutMsgs  int64
+	InBytes  int64
+	OutBytes int64
+	Rates    ConnRates
+}
+
+// GroupConns aggregates the connections of a snapshot by the given field,
+// with their rates over the given window as in OrderConns, returning the
+// groups with the most msgs per second first.
+func GroupConns(stats *Stats, by GroupBy, window int) []*Group {
+	groups := make(map[string]*Group)
+	for _, conn := range stats.Connz.Conns {
+		key := by.Key(conn)
+		g, ok := groups[key]
+		if !ok {
+			g = &Group{Key: key}
+			groups[key] = g
+		}
+
+		g.Conns++
+		g.NumSubs += conn.NumSubs
+		g.Pending += conn.Pending
+		g.InMsgs += conn.InMsgs
+		g.OutMsgs += conn.OutMsgs
+		g.InBytes += conn.InBytes
+		g.OutBytes += conn.OutBytes
+
+		if cr, ok := stats.Rates.Connections[conn.Cid]; ok {
+			crate := cr.Windowed(window)
+			g.Rates.InMsgsRate += crate.InMsgsRate
+			g.Rates.OutMsgsRate += crate.OutMsgsRate
+			g.Rates.InBytesRate += crate.InBytesRate
+			g.Rates.OutBytesRate += crate.OutBytesRate
+		}
+	}
+
+	sorted := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if ra, rb := a.Rates.InMsgsRate+a.Rates.OutMsgsRate, b.Rates.InMsgsRate+b.Rates.OutMsgsRate; ra != rb {
+			return ra > rb
+		}
+		if ma, mb := a.InMsgs+a.OutMsgs, b.InMsgs+b.OutMsgs; ma != mb {
+			return ma > mb
+		}
+		return a.Key < b.Key
+	})
+
+	return sorted
+}
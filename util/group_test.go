@@ -0,0 +1,92 @@
+package toputils_test
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestGroupConns(t *testing.T) {
+	stats := &top.Stats{
+		Connz: &server.Connz{Conns: []*server.ConnInfo{
+			{Cid: 1, Name: "orders", IP: "10.0.0.1", Account: "A", Lang: "go", Version: "1.30.0", NumSubs: 2, Pending: 10, InMsgs: 100, OutMsgs: 5},
+			{Cid: 2, Name: "orders", IP: "10.0.0.2", Account: "A", Lang: "go", Version: "1.30.0", NumSubs: 3, Pending: 20, InMsgs: 200, OutMsgs: 5},
+			{Cid: 3, Name: "billing", IP: "10.0.0.1", Account: "B", Lang: "java", Version: "2.17.0", NumSubs: 1, InMsgs: 50000},
+			{Cid: 4, IP: "10.0.0.3", Account: "A", Lang: "go", Version: "1.31.0", NumSubs: 1},
+		}},
+		Rates: &top.Rates{Connections: map[uint64]*top.ConnRates{
+			1: {InMsgsRate: 10, OutMsgsRate: 1, InBytesRate: 100},
+			2: {InMsgsRate: 20, OutMsgsRate: 2, InBytesRate: 200},
+			3: {InMsgsRate: 5},
+		}},
+	}
+
+	groups := top.GroupConns(stats, top.GroupByName, -1)
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got: %d", len(groups))
+	}
+
+	// The noisiest service comes first even with fewer msgs in total
+	orders := groups[0]
+	if orders.Key != "orders" {
+		t.Fatalf("Expected orders group first, got: %q", orders.Key)
+	}
+	if orders.Conns != 2 || orders.NumSubs != 5 || orders.Pending != 30 || orders.InMsgs != 300 || orders.OutMsgs != 10 {
+		t.Fatalf("Unexpected totals for orders group: %+v", orders)
+	}
+	if orders.Rates.InMsgsRate != 30 || orders.Rates.OutMsgsRate != 3 || orders.Rates.InBytesRate != 300 {
+		t.Fatalf("Unexpected rates for orders group: %+v", orders.Rates)
+	}
+	if groups[1].Key != "billing" || groups[2].Key != "" {
+		t.Fatalf("Expected billing and unnamed groups next, got: %q, %q", groups[1].Key, groups[2].Key)
+	}
+
+	testcases := map[top.GroupBy][]string{
+		top.GroupByIP:      {"10.0.0.2", "10.0.0.1", "10.0.0.3"},
+		top.GroupByAccount: {"A", "B"},
+		top.GroupByLang:    {"go 1.30.0", "java 2.17.0", "go 1.31.0"},
+	}
+	for by, want := range testcases {
+		groups := top.GroupConns(stats, by, -1)
+		if len(groups) != len(want) {
+			t.Fatalf("Expected %d groups by %s, got: %d", len(want), by, len(groups))
+		}
+		for i, g := range groups {
+			if g.Key != want[i] {
+				t.Errorf("Expected group %d by %s to be %q, got: %q", i, by, want[i], g.Key)
+			}
+		}
+	}
+
+	if !top.GroupByAccount.IsValid() || top.GroupBy("host").IsValid() {
+		t.Fatal("Unexpected validation of group by options")
+	}
+}
+
+func TestGroupConnsByAccount(t *testing.T) {
+	stats := &top.Stats{
+		Connz: &server.Connz{Conns: []*server.ConnInfo{
+			{Cid: 1, Account: "A"},
+			{Cid: 2, NameTag: "global"},
+			{Cid: 3, NameTag: "global"},
+		}},
+		Rates: &top.Rates{Connections: map[uint64]*top.ConnRates{
+			1: {InMsgsRate: 100, Averages: top.RateAverages{InMsgsRate: [3]float64{1, 0, 0}}},
+			2: {InMsgsRate: 1, Averages: top.RateAverages{InMsgsRate: [3]float64{10, 0, 0}}},
+			3: {InMsgsRate: 1, Averages: top.RateAverages{InMsgsRate: [3]float64{20, 0, 0}}},
+		}},
+	}
+
+	// The global account is known by its name tag
+	groups := top.GroupConns(stats, top.GroupByAccount, -1)
+	if len(groups) != 2 || groups[0].Key != "A" || groups[1].Key != "global" || groups[1].Conns != 2 {
+		t.Fatalf("Unexpected groups by account: %+v, %+v", groups[0], groups[1])
+	}
+
+	// The rates over the window are the ones aggregated and ordered by
+	groups = top.GroupConns(stats, top.GroupByAccount, 0)
+	if groups[0].Key != "global" || groups[0].Rates.InMsgsRate != 30 || groups[1].Rates.InMsgsRate != 1 {
+		t.Fatalf("Unexpected groups over the 1m window: %+v, %+v", groups[0], groups[1])
+	}
+}
@@ -0,0 +1,254 @@
+package toputils
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// DefaultHistorySize is the default number of snapshots kept in the history.
+const DefaultHistorySize = 300
+
+// History is a bounded ring buffer of the most recent Stats snapshots,
+// limited by number of snapshots and/or by their age.
+type History struct {
+	sync.RWMutex
+	maxLen int
+	maxAge time.Duration
+
+	buf  []*Stats
+	head int
+	size int
+}
+
+// NewHistory creates a history keeping at most maxLen snapshots taken
+// within maxAge of the latest one. A zero value disables either bound.
+func NewHistory(maxLen int, maxAge time.Duration) *History {
+	return &History{maxLen: maxLen, maxAge: maxAge}
+}
+
+// Add appends a snapshot, evicting the oldest ones that fall out of bounds.
+func (h *History) Add(stats *Stats) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.maxLen > 0 && h.size == h.maxLen {
+		h.buf[h.head] = nil
+		h.head = (h.head + 1) % len(h.buf)
+		h.size--
+	}
+	if h.size == len(h.buf) {
+		h.grow()
+	}
+	h.buf[(h.head+h.size)%len(h.buf)] = stats
+	h.size++
+
+	if h.maxAge > 0 {
+		cutoff := stats.Varz.Now.Add(-h.maxAge)
+		for h.size > 1 && h.buf[h.head].Varz.Now.Before(cutoff) {
+			h.buf[h.head] = nil
+			h.head = (h.head + 1) % len(h.buf)
+			h.size--
+		}
+	}
+}
+
+// grow doubles the capacity of the buffer without exceeding maxLen.
+func (h *History) grow() {
+	n := 2 * len(h.buf)
+	if n == 0 {
+		n = 16
+	}
+	if h.maxLen > 0 && n > h.maxLen {
+		n = h.maxLen
+	}
+
+	buf := make([]*Stats, n)
+	for i := 0; i < h.size; i++ {
+		buf[i] = h.buf[(h.head+i)%len(h.buf)]
+	}
+	h.buf = buf
+	h.head = 0
+}
+
+// Len returns the number of snapshots in the history.
+func (h *History) Len() int {
+	h.RLock()
+	defer h.RUnlock()
+	return h.size
+}
+
+// Snapshots returns the snapshots in the history, oldest first.
+func (h *History) Snapshots() []*Stats {
+	h.RLock()
+	defer h.RUnlock()
+
+	snapshots := make([]*Stats, h.size)
+	for i := range snapshots {
+		snapshots[i] = h.buf[(h.head+i)%len(h.buf)]
+	}
+	return snapshots
+}
+
+// Clone returns a copy of the history with the same snapshots and bounds,
+// which is not changed by the snapshots added to the history since.
+func (h *History) Clone() *History {
+	snapshots := h.Snapshots()
+	return &History{maxLen: h.maxLen, maxAge: h.maxAge, buf: snapshots, size: len(snapshots)}
+}
+
+// Latest returns the most recent snapshot or nil if the history is empty.
+func (h *History) Latest() *Stats {
+	h.RLock()
+	defer h.RUnlock()
+
+	if h.size == 0 {
+		return nil
+	}
+	return h.buf[(h.head+h.size-1)%len(h.buf)]
+}
+
+// Point is the value of a metric at the time of a snapshot.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Metric is a server level value that can be queried from the history.
+type Metric string
+
+const (
+	MetricCPU           Metric = "cpu"
+	MetricMem           Metric = "mem"
+	MetricConns         Metric = "conns"
+	MetricSubs          Metric = "subs"
+	MetricSlowConsumers Metric = "slow_consumers"
+	MetricInMsgs        Metric = "in_msgs"
+	MetricOutMsgs       Metric = "out_msgs"
+	MetricInBytes       Metric = "in_bytes"
+	MetricOutBytes      Metric = "out_bytes"
+	MetricInMsgsRate    Metric = "in_msgs_rate"
+	MetricOutMsgsRate   Metric = "out_msgs_rate"
+	MetricInBytesRate   Metric = "in_bytes_rate"
+	MetricOutBytesRate  Metric = "out_bytes_rate"
+)
+
+// Value returns the metric from a snapshot.
+func (metric Metric) Value(stats *Stats) float64 {
+	varz, rates := stats.Varz, stats.Rates
+	switch metric {
+	case MetricCPU:
+		return varz.CPU
+	case MetricMem:
+		return float64(varz.Mem)
+	case MetricConns:
+		return float64(varz.Connections)
+	case MetricSubs:
+		return float64(varz.Subscriptions)
+	case MetricSlowConsumers:
+		return float64(varz.SlowConsumers)
+	case MetricInMsgs:
+		return float64(varz.InMsgs)
+	case MetricOutMsgs:
+		return float64(varz.OutMsgs)
+	case MetricInBytes:
+		return float64(varz.InBytes)
+	case MetricOutBytes:
+		return float64(varz.OutBytes)
+	case MetricInMsgsRate:
+		return rates.InMsgsRate
+	case MetricOutMsgsRate:
+		return rates.OutMsgsRate
+	case MetricInBytesRate:
+		return rates.InBytesRate
+	case MetricOutBytesRate:
+		return rates.OutBytesRate
+	}
+	return 0
+}
+
+// ConnMetric is a per connection value that can be queried from the history.
+type ConnMetric string
+
+const (
+	ConnMetricSubs         ConnMetric = "subs"
+	ConnMetricPending      ConnMetric = "pending"
+	ConnMetricInMsgs       ConnMetric = "in_msgs"
+	ConnMetricOutMsgs      ConnMetric = "out_msgs"
+	ConnMetricInBytes      ConnMetric = "in_bytes"
+	ConnMetricOutBytes     ConnMetric = "out_bytes"
+	ConnMetricInMsgsRate   ConnMetric = "in_msgs_rate"
+	ConnMetricOutMsgsRate  ConnMetric = "out_msgs_rate"
+	ConnMetricInBytesRate  ConnMetric = "in_bytes_rate"
+	ConnMetricOutBytesRate ConnMetric = "out_bytes_rate"
+)
+
+// Value returns the metric for a connection from a snapshot,
+// and whether the connection was present in it.
+func (metric ConnMetric) Value(stats *Stats, cid uint64) (float64, bool) {
+	var conn *server.ConnInfo
+	for _, c := range stats.Connz.Conns {
+		if c.Cid == cid {
+			conn = c
+			break
+		}
+	}
+	if conn == nil {
+		return 0, false
+	}
+
+	crate := stats.Rates.Connections[cid]
+	if crate == nil {
+		crate = &ConnRates{}
+	}
+
+	switch metric {
+	case ConnMetricSubs:
+		return float64(conn.NumSubs), true
+	case ConnMetricPending:
+		return float64(conn.Pending), true
+	case ConnMetricInMsgs:
+		return float64(conn.InMsgs), true
+	case ConnMetricOutMsgs:
+		return float64(conn.OutMsgs), true
+	case ConnMetricInBytes:
+		return float64(conn.InBytes), true
+	case ConnMetricOutBytes:
+		return float64(conn.OutBytes), true
+	case ConnMetricInMsgsRate:
+		return crate.InMsgsRate, true
+	case ConnMetricOutMsgsRate:
+		return crate.OutMsgsRate, true
+	case ConnMetricInBytesRate:
+		return crate.InBytesRate, true
+	case ConnMetricOutBytesRate:
+		return crate.OutBytesRate, true
+	}
+	return 0, true
+}
+
+// Series returns the time series of a server metric, oldest first.
+func (h *History) Series(metric Metric) []Point {
+	snapshots := h.Snapshots()
+
+	points := make([]Point, 0, len(snapshots))
+	for _, stats := range snapshots {
+		points = append(points, Point{Time: stats.Varz.Now, Value: metric.Value(stats)})
+	}
+	return points
+}
+
+// ConnSeries returns the time series of a metric for the connection
+// with the given CID, oldest first, skipping snapshots without it.
+func (h *History) ConnSeries(cid uint64, metric ConnMetric) []Point {
+	snapshots := h.Snapshots()
+
+	points := make([]Point, 0, len(snapshots))
+	for _, stats := range snapshots {
+		if v, ok := metric.Value(stats, cid); ok {
+			points = append(points, Point{Time: stats.Connz.Now, Value: v})
+		}
+	}
+	return points
+}
@@ -0,0 +1,112 @@
+package toputils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func newSnapshot(now time.Time, inMsgs int64, conns ...*server.ConnInfo) *top.Stats {
+	rates := &top.Rates{
+		InMsgsRate:  float64(inMsgs) / 10,
+		Connections: make(map[uint64]*top.ConnRates),
+	}
+	for _, conn := range conns {
+		rates.Connections[conn.Cid] = &top.ConnRates{InMsgsRate: float64(conn.InMsgs) / 10}
+	}
+
+	return &top.Stats{
+		Varz:  &server.Varz{Now: now, InMsgs: inMsgs},
+		Connz: &server.Connz{Now: now, Conns: conns},
+		Rates: rates,
+	}
+}
+
+func TestHistoryBoundedByCount(t *testing.T) {
+	history := top.NewHistory(50, 0)
+	if history.Latest() != nil {
+		t.Fatal("Expected empty history")
+	}
+
+	start := time.Now()
+	for i := 0; i < 120; i++ {
+		history.Add(newSnapshot(start.Add(time.Duration(i)*time.Second), int64(i)))
+	}
+
+	if got := history.Len(); got != 50 {
+		t.Fatalf("Expected 50 snapshots, got: %d", got)
+	}
+
+	snapshots := history.Snapshots()
+	for i, stats := range snapshots {
+		if want := int64(70 + i); stats.Varz.InMsgs != want {
+			t.Fatalf("Expected snapshot %d to have %d in msgs, got: %d", i, want, stats.Varz.InMsgs)
+		}
+	}
+	if history.Latest() != snapshots[len(snapshots)-1] {
+		t.Fatal("Expected latest snapshot to be the last one added")
+	}
+}
+
+func TestHistoryBoundedByDuration(t *testing.T) {
+	history := top.NewHistory(0, time.Minute)
+
+	start := time.Now()
+	for i := 0; i < 300; i++ {
+		history.Add(newSnapshot(start.Add(time.Duration(i)*time.Second), int64(i)))
+	}
+
+	snapshots := history.Snapshots()
+	if got := len(snapshots); got != 61 {
+		t.Fatalf("Expected snapshots within the last minute, got: %d", got)
+	}
+	if got := snapshots[0].Varz.InMsgs; got != 239 {
+		t.Fatalf("Expected oldest snapshot to have 239 in msgs, got: %d", got)
+	}
+}
+
+func TestHistorySeries(t *testing.T) {
+	history := top.NewHistory(10, 0)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		conns := []*server.ConnInfo{{Cid: 1, InMsgs: int64(i * 100), Pending: i}}
+		// Connection 2 only shows up in every other poll
+		if i%2 == 0 {
+			conns = append(conns, &server.ConnInfo{Cid: 2, InMsgs: int64(i * 10)})
+		}
+		history.Add(newSnapshot(start.Add(time.Duration(i)*time.Second), int64(i*1000), conns...))
+	}
+
+	series := history.Series(top.MetricInMsgsRate)
+	if len(series) != 5 {
+		t.Fatalf("Expected 5 points, got: %d", len(series))
+	}
+	for i, p := range series {
+		if want := float64(i * 100); p.Value != want {
+			t.Fatalf("Expected point %d to be %v, got: %v", i, want, p.Value)
+		}
+		if !p.Time.Equal(start.Add(time.Duration(i) * time.Second)) {
+			t.Fatalf("Unexpected time for point %d: %v", i, p.Time)
+		}
+	}
+
+	series = history.ConnSeries(1, top.ConnMetricPending)
+	if len(series) != 5 || series[4].Value != 4 {
+		t.Fatalf("Expected pending series for connection 1, got: %+v", series)
+	}
+
+	series = history.ConnSeries(2, top.ConnMetricInMsgsRate)
+	if len(series) != 3 {
+		t.Fatalf("Expected 3 points for connection 2, got: %d", len(series))
+	}
+	if series[2].Value != 4 {
+		t.Fatalf("Expected last in msgs rate of connection 2 to be 4, got: %v", series[2].Value)
+	}
+
+	if series := history.ConnSeries(3, top.ConnMetricInMsgs); len(series) != 0 {
+		t.Fatalf("Expected no points for unknown connection, got: %d", len(series))
+	}
+}
@@ -0,0 +1,280 @@
+package toputils
+
+import (
+	"cmp"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// Column is a column of the connections table, which they can be ordered by.
+type Column string
+
+const (
+	ColumnNone      Column = ""
+	ColumnHost      Column = "host"
+	ColumnCid       Column = "cid"
+	ColumnName      Column = "name"
+	ColumnAccount   Column = "account"
+	ColumnKind      Column = "kind"
+	ColumnSubs      Column = "subs"
+	ColumnPending   Column = "pending"
+	ColumnMsgsTo    Column = "msgs_to"
+	ColumnMsgsFrom  Column = "msgs_from"
+	ColumnBytesTo   Column = "bytes_to"
+	ColumnBytesFrom Column = "bytes_from"
+	ColumnRTT       Column = "rtt"
+	ColumnTLS       Column = "tls"
+	ColumnLang      Column = "lang"
+	ColumnVersion   Column = "version"
+	ColumnUptime    Column = "uptime"
+	ColumnLast      Column = "last"
+)
+
+// OrderColumns are the columns the connections can be ordered by.
+var OrderColumns = []Column{
+	ColumnHost, ColumnCid, ColumnName, ColumnAccount, ColumnKind,
+	ColumnSubs, ColumnPending, ColumnMsgsTo, ColumnMsgsFrom, ColumnBytesTo,
+	ColumnBytesFrom, ColumnRTT, ColumnTLS, ColumnLang, ColumnVersion,
+	ColumnUptime, ColumnLast,
+}
+
+// IsValid determines if the connections can be ordered by a column.
+func (c Column) IsValid() bool {
+	for _, col := range OrderColumns {
+		if c == col {
+			return true
+		}
+	}
+	return c == ColumnNone
+}
+
+// Descending reports whether the column is ordered from the highest value
+// by default, as the server does for counters, or else alphabetically.
+func (c Column) Descending() bool {
+	switch c {
+	case ColumnHost, ColumnCid, ColumnName, ColumnAccount, ColumnKind, ColumnTLS, ColumnLang, ColumnVersion:
+		return false
+	}
+	return true
+}
+
+// Windowed returns the rates over the moving average window, one of
+// Avg1m, Avg5m or Avg15m, or the instant rates for a negative window.
+func (cr *ConnRates) Windowed(window int) ConnRates {
+	if window < 0 {
+		return *cr
+	}
+	rates := *cr
+	rates.InMsgsRate = cr.Averages.InMsgsRate[window]
+	rates.OutMsgsRate = cr.Averages.OutMsgsRate[window]
+	rates.InBytesRate = cr.Averages.InBytesRate[window]
+	rates.OutBytesRate = cr.Averages.OutBytesRate[window]
+	return rates
+}
+
+// OrderConns returns the connections of a snapshot ordered by a column.
+// The msgs and bytes columns are ordered by their rates over the given
+// window when useRates is set, as they are displayed then. Ties keep
+// the order of the server.
+func OrderConns(stats *Stats, column Column, desc bool, useRates bool, window int) []*server.ConnInfo {
+	conns := append([]*server.ConnInfo(nil), stats.Connz.Conns...)
+	if column == ColumnNone {
+		return conns
+	}
+
+	rate := func(conn *server.ConnInfo) ConnRates {
+		if cr := stats.Rates.Connections[conn.Cid]; cr != nil {
+			return cr.Windowed(window)
+		}
+		return ConnRates{}
+	}
+
+	var order func(a, b *server.ConnInfo) int
+	switch column {
+	case ColumnHost:
+		order = func(a, b *server.ConnInfo) int {
+			if c := compareIP(a.IP, b.IP); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.Port, b.Port)
+		}
+	case ColumnCid:
+		order = func(a, b *server.ConnInfo) int { return cmp.Compare(a.Cid, b.Cid) }
+	case ColumnName:
+		order = func(a, b *server.ConnInfo) int { return strings.Compare(a.Name, b.Name) }
+	case ColumnAccount:
+		order = func(a, b *server.ConnInfo) int { return strings.Compare(ConnAccount(a), ConnAccount(b)) }
+	case ColumnKind:
+		order = func(a, b *server.ConnInfo) int { return strings.Compare(a.Kind, b.Kind) }
+	case ColumnSubs:
+		order = func(a, b *server.ConnInfo) int { return cmp.Compare(a.NumSubs, b.NumSubs) }
+	case ColumnPending:
+		order = func(a, b *server.ConnInfo) int { return cmp.Compare(a.Pending, b.Pending) }
+	case ColumnMsgsTo:
+		order = func(a, b *server.ConnInfo) int {
+			if useRates {
+				return cmp.Compare(rate(a).OutMsgsRate, rate(b).OutMsgsRate)
+			}
+			return cmp.Compare(a.OutMsgs, b.OutMsgs)
+		}
+	case ColumnMsgsFrom:
+		order = func(a, b *server.ConnInfo) int {
+			if useRates {
+				return cmp.Compare(rate(a).InMsgsRate, rate(b).InMsgsRate)
+			}
+			return cmp.Compare(a.InMsgs, b.InMsgs)
+		}
+	case ColumnBytesTo:
+		order = func(a, b *server.ConnInfo) int {
+			if useRates {
+				return cmp.Compare(rate(a).OutBytesRate, rate(b).OutBytesRate)
+			}
+			return cmp.Compare(a.OutBytes, b.OutBytes)
+		}
+	case ColumnBytesFrom:
+		order = func(a, b *server.ConnInfo) int {
+			if useRates {
+				return cmp.Compare(rate(a).InBytesRate, rate(b).InBytesRate)
+			}
+			return cmp.Compare(a.InBytes, b.InBytes)
+		}
+	case ColumnRTT:
+		order = func(a, b *server.ConnInfo) int { return cmp.Compare(ParseRTT(a.RTT), ParseRTT(b.RTT)) }
+	case ColumnTLS:
+		order = func(a, b *server.ConnInfo) int { return strings.Compare(a.TLSVersion, b.TLSVersion) }
+	case ColumnLang:
+		order = func(a, b *server.ConnInfo) int { return strings.Compare(a.Lang, b.Lang) }
+	case ColumnVersion:
+		order = func(a, b *server.ConnInfo) int { return strings.Compare(a.Version, b.Version) }
+	case ColumnUptime:
+		// The earlier a connection started the longer its uptime
+		order = func(a, b *server.ConnInfo) int { return b.Start.Compare(a.Start) }
+	case ColumnLast:
+		order = func(a, b *server.ConnInfo) int { return a.LastActivity.Compare(b.LastActivity) }
+	default:
+		return conns
+	}
+
+	sort.SliceStable(conns, func(i, j int) bool {
+		if desc {
+			return order(conns[i], conns[j]) > 0
+		}
+		return order(conns[i], conns[j]) < 0
+	})
+	return conns
+}
+
+// compareIP compares addresses numerically, falling back to
+// comparing them as text if they can't be parsed.
+func compareIP(a, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return strings.Compare(a, b)
+	}
+	return strings.Compare(string(ipA.To16()), string(ipB.To16()))
+}
+
+// Direction is the direction to sort or order connections in, given by
+// prefixing the option with + for ascending or - for descending.
+type Direction int
+
+const (
+	DirectionDefault Direction = iota
+	Ascending
+	Descending
+)
+
+// SplitDirection returns an option without its +/- prefix,
+// and the direction given by it.
+func SplitDirection(opt string) (string, Direction) {
+	switch {
+	case strings.HasPrefix(opt, "+"):
+		return opt[1:], Ascending
+	case strings.HasPrefix(opt, "-"):
+		return opt[1:], Descending
+	}
+	return opt, DirectionDefault
+}
+
+// Prefix returns the prefix of an option for the direction.
+func (d Direction) Prefix() string {
+	switch d {
+	case Ascending:
+		return "+"
+	case Descending:
+		return "-"
+	}
+	return ""
+}
+
+// IsDescending reports whether the direction is descending,
+// given whether the default one is.
+func (d Direction) IsDescending(byDefault bool) bool {
+	switch d {
+	case Ascending:
+		return false
+	case Descending:
+		return true
+	}
+	return byDefault
+}
+
+// connzSort is a sort option of the connections and its direction.
+type connzSort struct {
+	opt server.SortOpt
+	dir Direction
+}
+
+// SetSort changes the sort option and direction of the polled connections.
+func (engine *Engine) SetSort(opt server.SortOpt, dir Direction) {
+	engine.sort.Store(&connzSort{opt: opt, dir: dir})
+	engine.requestPoll()
+}
+
+// Sort returns the sort option and direction of the polled connections,
+// which are SortOpt and SortDirection unless others were set.
+func (engine *Engine) Sort() (server.SortOpt, Direction) {
+	if sort := engine.sort.Load(); sort != nil {
+		return sort.opt, sort.dir
+	}
+	return engine.SortOpt, engine.SortDirection
+}
+
+// SortOrder returns the column matching a server sort option and whether
+// it is ordered descending in the given direction. The server sorts
+// descending for all the options but the CID and start time.
+func SortOrder(opt server.SortOpt, dir Direction) (Column, bool) {
+	var column Column
+	reversed := false
+	switch opt {
+	case server.ByCid, server.ByStart, "":
+		return ColumnCid, dir.IsDescending(false)
+	case server.BySubs:
+		column = ColumnSubs
+	case server.ByPending:
+		column = ColumnPending
+	case server.ByOutMsgs:
+		column = ColumnMsgsTo
+	case server.ByInMsgs:
+		column = ColumnMsgsFrom
+	case server.ByOutBytes:
+		column = ColumnBytesTo
+	case server.ByInBytes:
+		column = ColumnBytesFrom
+	case server.ByRTT:
+		column = ColumnRTT
+	case server.ByUptime:
+		column = ColumnUptime
+	case server.ByLast:
+		column = ColumnLast
+	case server.ByIdle:
+		// The most idle connections are the least recently active
+		column, reversed = ColumnLast, true
+	default:
+		return ColumnNone, false
+	}
+	return column, dir.IsDescending(true) != reversed
+}
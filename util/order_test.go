@@ -0,0 +1,149 @@
+package toputils_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestOrderConns(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	stats := &top.Stats{
+		Connz: &server.Connz{Conns: []*server.ConnInfo{
+			{Cid: 1, Name: "orders", IP: "10.0.0.10", Port: 4000, OutMsgs: 1000, RTT: "2ms", Start: start},
+			{Cid: 2, Name: "billing", IP: "10.0.0.9", Port: 4000, OutMsgs: 10, RTT: "150µs", Start: start.Add(time.Minute)},
+			{Cid: 3, Name: "audit", IP: "10.0.0.9", Port: 3000, OutMsgs: 500, Start: start.Add(-time.Minute)},
+		}},
+		Rates: &top.Rates{Connections: map[uint64]*top.ConnRates{
+			1: {OutMsgsRate: 1},
+			2: {OutMsgsRate: 50, Averages: top.RateAverages{OutMsgsRate: [3]float64{0, 5, 0}}},
+			3: {OutMsgsRate: 20, Averages: top.RateAverages{OutMsgsRate: [3]float64{0, 30, 0}}},
+		}},
+	}
+
+	cids := func(conns []*server.ConnInfo) string {
+		var ids []uint64
+		for _, conn := range conns {
+			ids = append(ids, conn.Cid)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	testcases := map[string]struct {
+		column   top.Column
+		desc     bool
+		useRates bool
+		window   int
+		want     string
+	}{
+		"as sorted by the server": {column: top.ColumnNone, want: "[1 2 3]"},
+		"by name":                 {column: top.ColumnName, want: "[3 2 1]"},
+		"by host":                 {column: top.ColumnHost, want: "[3 2 1]"},
+		"by msgs to":              {column: top.ColumnMsgsTo, desc: true, want: "[1 3 2]"},
+		"by msgs to rate":         {column: top.ColumnMsgsTo, desc: true, useRates: true, window: -1, want: "[2 3 1]"},
+		"by msgs to 5m average":   {column: top.ColumnMsgsTo, desc: true, useRates: true, window: top.Avg5m, want: "[3 2 1]"},
+		"by rtt":                  {column: top.ColumnRTT, desc: true, want: "[1 2 3]"},
+		"by uptime":               {column: top.ColumnUptime, desc: true, want: "[3 1 2]"},
+		"by uptime ascending":     {column: top.ColumnUptime, want: "[2 1 3]"},
+	}
+	for name, tc := range testcases {
+		t.Run(name, func(t *testing.T) {
+			got := cids(top.OrderConns(stats, tc.column, tc.desc, tc.useRates, tc.window))
+			if got != tc.want {
+				t.Fatalf("Expected connections %s, got: %s", tc.want, got)
+			}
+		})
+	}
+
+	if got := cids(stats.Connz.Conns); got != "[1 2 3]" {
+		t.Fatalf("Expected the snapshot to keep the order of the server, got: %s", got)
+	}
+}
+
+func TestSortOrder(t *testing.T) {
+	testcases := map[string]struct {
+		column top.Column
+		desc   bool
+	}{
+		"cid":         {top.ColumnCid, false},
+		"-cid":        {top.ColumnCid, true},
+		"msgs_to":     {top.ColumnMsgsTo, true},
+		"+msgs_to":    {top.ColumnMsgsTo, false},
+		"-rtt":        {top.ColumnRTT, true},
+		"idle":        {top.ColumnLast, false},
+		"+idle":       {top.ColumnLast, true},
+		"reason":      {top.ColumnNone, false},
+		"+bytes_from": {top.ColumnBytesFrom, false},
+	}
+	for opt, tc := range testcases {
+		name, dir := top.SplitDirection(opt)
+		if got := dir.Prefix() + name; got != opt {
+			t.Fatalf("Expected %q to keep its prefix, got: %q", opt, got)
+		}
+		column, desc := top.SortOrder(server.SortOpt(name), dir)
+		if column != tc.column || desc != tc.desc {
+			t.Fatalf("Expected %q to order by %q (descending: %v), got: %q (descending: %v)", opt, tc.column, tc.desc, column, desc)
+		}
+	}
+}
+
+func TestFetchStatsSortDirection(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	engine.SortOpt = server.ByPending
+	engine.SortDirection = top.Ascending
+
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		connz.Conns = []*server.ConnInfo{
+			{Cid: 1, Pending: 300},
+			{Cid: 2, Pending: 200},
+			{Cid: 3, Pending: 100},
+		}
+	})
+
+	var cids []uint64
+	for _, conn := range engine.FetchStatsSnapshot().Connz.Conns {
+		cids = append(cids, conn.Cid)
+	}
+	if got := fmt.Sprint(cids); got != "[3 2 1]" {
+		t.Fatalf("Expected polled connections in ascending pending order, got: %s", got)
+	}
+}
+
+func TestSetSortWhileMonitoring(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+
+	var queries []string
+	fm.Lock()
+	fm.onRequest = func(q string) { queries = append(queries, q) }
+	fm.Unlock()
+
+	// The sort is changed from this goroutine, as the UI does,
+	// while the engine polls, with a poll right away on every change.
+	engine.Delay = 3600
+	runMonitorStats(t, engine)
+	<-engine.StatsCh
+
+	for _, sortOpt := range []server.SortOpt{server.BySubs, server.ByPending, server.ByOutMsgs} {
+		engine.SetSort(sortOpt, top.Ascending)
+		if opt, dir := engine.Sort(); opt != sortOpt || dir != top.Ascending {
+			t.Fatalf("Expected sort by +%s, got: %s%s", sortOpt, dir.Prefix(), opt)
+		}
+
+		select {
+		case <-engine.StatsCh:
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for a poll after the sort changed")
+		}
+
+		fm.Lock()
+		query := queries[len(queries)-1]
+		fm.Unlock()
+		if !strings.Contains(query, "sort="+string(sortOpt)) {
+			t.Fatalf("Expected connections sorted by %s to be requested, got: %q", sortOpt, query)
+		}
+	}
+}
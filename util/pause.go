@@ -0,0 +1,35 @@
+package toputils
+
+// Pause is the display frozen on the stats polled when it was paused,
+// along with the history as it was then, while the polling goes on.
+type Pause struct {
+	history *History
+	held    map[Tab]*Stats
+}
+
+// NewPause pauses the display of the stats kept in the given history.
+func NewPause(history *History) *Pause {
+	return &Pause{history: history.Clone(), held: make(map[Tab]*Stats)}
+}
+
+// History returns the history as it was when paused.
+func (p *Pause) History() *History {
+	return p.history
+}
+
+// Hold keeps the stats polled while paused, the latest ones of each tab.
+func (p *Pause) Hold(stats *Stats) {
+	p.held[stats.Tab] = stats
+}
+
+// Resume returns the latest stats of each tab polled while paused, to be
+// displayed once resumed, in the order of the tabs.
+func (p *Pause) Resume() []*Stats {
+	var held []*Stats
+	for _, tab := range Tabs {
+		if stats, ok := p.held[tab]; ok {
+			held = append(held, stats)
+		}
+	}
+	return held
+}
@@ -0,0 +1,55 @@
+package toputils_test
+
+import (
+	"testing"
+	"time"
+
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestPauseKeepsHistory(t *testing.T) {
+	history := top.NewHistory(3, 0)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		history.Add(newSnapshot(start.Add(time.Duration(i)*time.Second), int64(i)))
+	}
+
+	pause := top.NewPause(history)
+	paused := pause.History().Latest()
+
+	// The polls while paused are not in the history displayed
+	for i := 3; i < 6; i++ {
+		history.Add(newSnapshot(start.Add(time.Duration(i)*time.Second), int64(i)))
+	}
+	if got := pause.History().Latest(); got != paused {
+		t.Fatalf("Expected the history as it was when paused, got the snapshot of %s", got.Varz.Now)
+	}
+	series := pause.History().Series(top.MetricInMsgs)
+	if len(series) != 3 || series[0].Value != 0 || series[2].Value != 2 {
+		t.Fatalf("Unexpected series of the paused history: %+v", series)
+	}
+	if history.Latest().Varz.InMsgs != 5 {
+		t.Fatal("Expected the history to keep being added to")
+	}
+}
+
+func TestPauseHoldsLatestOfEachTab(t *testing.T) {
+	pause := top.NewPause(top.NewHistory(10, 0))
+	if held := pause.Resume(); len(held) != 0 {
+		t.Fatalf("Expected nothing held, got: %+v", held)
+	}
+
+	first := &top.Stats{Tab: top.TabConnections}
+	latest := &top.Stats{Tab: top.TabConnections}
+	routes := &top.Stats{Tab: top.TabRoutes}
+	server := &top.Stats{Tab: top.TabServer}
+	for _, stats := range []*top.Stats{first, routes, latest, server} {
+		pause.Hold(stats)
+	}
+
+	// Each tab has its latest stats displayed once resumed
+	held := pause.Resume()
+	if len(held) != 3 || held[0] != server || held[1] != latest || held[2] != routes {
+		t.Fatalf("Expected the latest stats of each tab in order, got: %+v", held)
+	}
+}
@@ -0,0 +1,62 @@
+package toputils
+
+import (
+	"time"
+)
+
+// PendingWarningPolls is the number of consecutive polls in which the
+// pending bytes of a connection have to grow before warning about it.
+const PendingWarningPolls = 3
+
+// PendingTrend represents how the pending bytes of a connection have
+// been growing across polls, which is how slow consumers start out.
+type PendingTrend struct {
+	// Polls is the number of consecutive polls in which pending grew.
+	Polls int
+
+	// Rate is the average growth in bytes per second since pending
+	// started growing.
+	Rate float64
+
+	// TimeToMax estimates how long until pending reaches the max_pending
+	// of the server at the current rate, or zero if it is unknown.
+	TimeToMax time.Duration
+
+	// since and base are the time and pending bytes when growth started.
+	since time.Time
+	base  int
+}
+
+// Warning reports whether pending has been growing long enough for
+// the connection to be at risk of becoming a slow consumer.
+func (trend PendingTrend) Warning() bool {
+	return trend.Polls >= PendingWarningPolls
+}
+
+// next returns the trend updated with the pending bytes of two polls,
+// taken at last and now. The trend starts over when pending doesn't grow.
+func (trend PendingTrend) next(lastPending, pending int, last, now time.Time, maxPending int64) PendingTrend {
+	if pending <= lastPending {
+		return PendingTrend{}
+	}
+	if trend.Polls == 0 {
+		trend.since = last
+		trend.base = lastPending
+	}
+	trend.Polls++
+
+	if elapsed := now.Sub(trend.since); elapsed > 0 {
+		trend.Rate = float64(pending-trend.base) / elapsed.Seconds()
+	}
+
+	trend.TimeToMax = 0
+	if maxPending > 0 && trend.Rate > 0 {
+		left := maxPending - int64(pending)
+		if left < 0 {
+			left = 0
+		}
+		trend.TimeToMax = time.Duration(float64(left) / trend.Rate * float64(time.Second))
+	}
+
+	return trend
+}
@@ -0,0 +1,51 @@
+package toputils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+func TestPendingTrend(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	poll := func(i, pending int) {
+		now := start.Add(time.Duration(i) * time.Second)
+		fm.update(func(varz *server.Varz, connz *server.Connz) {
+			varz.Now, connz.Now = now, now
+			varz.MaxPending = 10000
+			connz.Conns = []*server.ConnInfo{{Cid: 1, Start: start, Pending: pending}}
+		})
+	}
+
+	poll(0, 1000)
+	engine.FetchStatsSnapshot()
+	for i, pending := range []int{2000, 3000} {
+		poll(i+1, pending)
+		trend := engine.FetchStatsSnapshot().Rates.Connections[1].Pending
+		if trend.Warning() {
+			t.Fatalf("Expected no warning after %d polls, got: %+v", trend.Polls, trend)
+		}
+	}
+
+	poll(3, 4000)
+	trend := engine.FetchStatsSnapshot().Rates.Connections[1].Pending
+	if !trend.Warning() {
+		t.Fatalf("Expected warning after pending kept growing, got: %+v", trend)
+	}
+	if trend.Rate != 1000 {
+		t.Fatalf("Expected pending to grow 1000 bytes/sec, got: %v", trend.Rate)
+	}
+	if trend.TimeToMax != 6*time.Second {
+		t.Fatalf("Expected max_pending to be reached in 6s, got: %v", trend.TimeToMax)
+	}
+
+	// Once pending stops growing the trend starts over
+	poll(4, 4000)
+	trend = engine.FetchStatsSnapshot().Rates.Connections[1].Pending
+	if trend.Warning() || trend.Polls != 0 || trend.Rate != 0 {
+		t.Fatalf("Expected trend to start over, got: %+v", trend)
+	}
+}
@@ -0,0 +1,84 @@
+package toputils
+
+import "sync"
+
+// MaxLookups is the number of host names looked up at once.
+const MaxLookups = 8
+
+// Resolver looks up the host names of client IPs in the background, so
+// they are displayed once known instead of waiting for the DNS. Each IP
+// is only looked up once.
+type Resolver struct {
+	// Resolved is signalled whenever a host name was looked up.
+	Resolved chan struct{}
+
+	mu      sync.Mutex
+	lookups map[string]*lookup
+	lookup  func(addr string) ([]string, error)
+	slots   chan struct{}
+}
+
+// lookup is the host name of an IP, or an empty string if it has none,
+// set once done is closed.
+type lookup struct {
+	done     chan struct{}
+	hostname string
+}
+
+// NewResolver returns a resolver looking up host names with the given
+// function, e.g. net.LookupAddr.
+func NewResolver(lookupAddr func(addr string) ([]string, error)) *Resolver {
+	return &Resolver{
+		Resolved: make(chan struct{}, 1),
+		lookups:  make(map[string]*lookup),
+		lookup:   lookupAddr,
+		slots:    make(chan struct{}, MaxLookups),
+	}
+}
+
+// Lookup returns the host name of an IP if it was already looked up, or
+// else starts looking it up in the background and returns false.
+func (r *Resolver) Lookup(ip string) (string, bool) {
+	l := r.start(ip)
+	select {
+	case <-l.done:
+		return l.hostname, l.hostname != ""
+	default:
+		return "", false
+	}
+}
+
+// Resolve returns the host name of an IP, waiting for it to be looked up.
+func (r *Resolver) Resolve(ip string) (string, bool) {
+	l := r.start(ip)
+	<-l.done
+	return l.hostname, l.hostname != ""
+}
+
+// start returns the lookup of an IP, starting it if there is none yet.
+func (r *Resolver) start(ip string) *lookup {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.lookups[ip]; ok {
+		return l
+	}
+	l := &lookup{done: make(chan struct{})}
+	r.lookups[ip] = l
+
+	go func() {
+		r.slots <- struct{}{}
+		// The host name can be empty even though there were no errors
+		if addrs, err := r.lookup(ip); err == nil && len(addrs) > 0 {
+			l.hostname = addrs[0]
+		}
+		<-r.slots
+		close(l.done)
+
+		select {
+		case r.Resolved <- struct{}{}:
+		default:
+		}
+	}()
+	return l
+}
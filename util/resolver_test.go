@@ -0,0 +1,54 @@
+package toputils_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestResolver(t *testing.T) {
+	release := make(chan struct{})
+	var lookups atomic.Int32
+	resolver := top.NewResolver(func(addr string) ([]string, error) {
+		lookups.Add(1)
+		<-release
+		if addr == "10.0.0.2" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"host-" + addr}, nil
+	})
+
+	// The lookup does not block while the DNS is slow
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if hostname, ok := resolver.Lookup("10.0.0.1"); ok {
+			t.Errorf("Expected no host name before it was looked up, got: %q", hostname)
+		}
+		resolver.Lookup("10.0.0.1")
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the lookup to return")
+	}
+	close(release)
+
+	select {
+	case <-resolver.Resolved:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the host name to be looked up")
+	}
+	if hostname, ok := resolver.Lookup("10.0.0.1"); !ok || hostname != "host-10.0.0.1" {
+		t.Fatalf("Expected the looked up host name, got: %q", hostname)
+	}
+	if hostname, ok := resolver.Resolve("10.0.0.2"); ok {
+		t.Fatalf("Expected no host name of an unknown IP, got: %q", hostname)
+	}
+	if n := lookups.Load(); n != 2 {
+		t.Fatalf("Expected each IP to be looked up once, got: %d", n)
+	}
+}
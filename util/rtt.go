@@ -0,0 +1,58 @@
+package toputils
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// DefaultHighRTT is the default round trip time from which the
+// latency of a connection is considered high.
+const DefaultHighRTT = 100 * time.Millisecond
+
+// ParseRTT returns the round trip time reported by the server for
+// a connection, or zero if it is unknown.
+func ParseRTT(rtt string) time.Duration {
+	d, err := time.ParseDuration(rtt)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// FormatRTT shortens the round trip time reported by the server
+// for a connection so that it fits in a column, e.g. 1.197654ms as 1.2ms.
+func FormatRTT(rtt string) string {
+	d, err := time.ParseDuration(rtt)
+	if err != nil {
+		return rtt
+	}
+	switch {
+	case d >= time.Second:
+		d = d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		d = d.Round(10 * time.Microsecond)
+	default:
+		d = d.Round(time.Microsecond)
+	}
+	return d.String()
+}
+
+// sortConnsByRTT sorts the connections by round trip time, highest first
+// as the server does, for servers which can't sort them by it.
+func sortConnsByRTT(conns []*server.ConnInfo) {
+	sort.SliceStable(conns, func(i, j int) bool {
+		return ParseRTT(conns[i].RTT) > ParseRTT(conns[j].RTT)
+	})
+}
+
+// connzSortOpt returns the sort option to request connections with,
+// falling back to the default one when the server can't sort by it.
+func (engine *Engine) connzSortOpt() server.SortOpt {
+	sortOpt, _ := engine.Sort()
+	if sortOpt == server.ByRTT && engine.noServerRTTSort {
+		return server.ByCid
+	}
+	return sortOpt
+}
@@ -0,0 +1,59 @@
+package toputils_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestFormatRTT(t *testing.T) {
+	for rtt, want := range map[string]string{
+		"":           "",
+		"1.197654ms": "1.2ms",
+		"887.123µs":  "887µs",
+		"2.3456789s": "2.346s",
+		"unknown":    "unknown",
+	} {
+		if got := top.FormatRTT(rtt); got != want {
+			t.Errorf("Expected %q to be formatted as %q, got: %q", rtt, want, got)
+		}
+	}
+
+	if got := top.ParseRTT("1.5ms"); got != 1500*time.Microsecond {
+		t.Fatalf("Expected 1.5ms, got: %v", got)
+	}
+	if got := top.ParseRTT(""); got != 0 {
+		t.Fatalf("Expected unknown RTT to be zero, got: %v", got)
+	}
+}
+
+func TestSortByRTTFallback(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	engine.SortOpt = server.ByRTT
+
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		connz.Conns = []*server.ConnInfo{
+			{Cid: 1, RTT: "500µs"},
+			{Cid: 2, RTT: "20ms"},
+			{Cid: 3},
+			{Cid: 4, RTT: "1.5ms"},
+		}
+		fm.rejectSort = server.ByRTT
+	})
+
+	stats := engine.FetchStatsSnapshot()
+	if stats.Stale {
+		t.Fatalf("Expected to fall back to sorting by rtt locally, got: %v", stats.Error)
+	}
+
+	var cids []uint64
+	for _, conn := range stats.Connz.Conns {
+		cids = append(cids, conn.Cid)
+	}
+	if want := []uint64{2, 4, 1, 3}; fmt.Sprint(cids) != fmt.Sprint(want) {
+		t.Fatalf("Expected connections sorted by rtt %v, got: %v", want, cids)
+	}
+}
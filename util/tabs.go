@@ -0,0 +1,130 @@
+package toputils
+
+import (
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// Tab is a view of the monitored server, which only needs some of the
+// monitoring endpoints to be polled.
+type Tab int
+
+const (
+	// TabConnections is the server stats and the table of connections,
+	// the only tab whose polls are kept in the history and used for rates.
+	TabConnections Tab = iota
+	TabServer
+	TabRoutes
+	TabGateways
+	TabLeafs
+	TabJetStream
+	TabAccounts
+)
+
+// Tabs are the tabs in the order they are displayed.
+var Tabs = []Tab{
+	TabServer, TabConnections, TabRoutes, TabGateways, TabLeafs, TabJetStream, TabAccounts,
+}
+
+var tabNames = map[Tab]string{
+	TabServer:      "Server",
+	TabConnections: "Connections",
+	TabRoutes:      "Routes",
+	TabGateways:    "Gateways",
+	TabLeafs:       "Leafs",
+	TabJetStream:   "JetStream",
+	TabAccounts:    "Accounts",
+}
+
+func (tab Tab) String() string {
+	return tabNames[tab]
+}
+
+// Endpoints returns the monitoring endpoints polled for a tab.
+func (tab Tab) Endpoints() []string {
+	switch tab {
+	case TabServer:
+		return []string{"/varz"}
+	case TabRoutes:
+		return []string{"/routez"}
+	case TabGateways:
+		return []string{"/gatewayz"}
+	case TabLeafs:
+		return []string{"/leafz"}
+	case TabJetStream:
+		return []string{"/jsz"}
+	case TabAccounts:
+		return []string{"/accstatz"}
+	}
+	return []string{"/varz", "/connz"}
+}
+
+// SetTab makes the engine poll only the endpoints of a tab.
+func (engine *Engine) SetTab(tab Tab) {
+	if Tab(engine.tab.Swap(int32(tab))) == tab {
+		return
+	}
+	engine.requestPoll()
+}
+
+// CurrentTab returns the tab the engine polls the endpoints of.
+func (engine *Engine) CurrentTab() Tab {
+	return Tab(engine.tab.Load())
+}
+
+// fetchTab polls the endpoints of a tab other than the connections one,
+// leaving the rates and the history of the connections tab untouched.
+func (engine *Engine) fetchTab(tab Tab) *Stats {
+	stats := &Stats{
+		Tab:   tab,
+		Varz:  &server.Varz{},
+		Connz: &server.Connz{},
+		Rates: &Rates{},
+		Error: errDud,
+
+		LastRestart: engine.LastRestart,
+	}
+
+	for _, path := range tab.Endpoints() {
+		result, err := engine.Request(path)
+		if err != nil {
+			return engine.failedTab(tab, err)
+		}
+
+		switch statz := result.(type) {
+		case *server.Varz:
+			stats.Varz = statz
+		case *server.Routez:
+			stats.Routez = statz
+		case *server.Gatewayz:
+			stats.Gatewayz = statz
+		case *server.Leafz:
+			stats.Leafz = statz
+		case *server.JSInfo:
+			stats.Jsz = statz
+		case *server.AccountStatz:
+			stats.Accstatz = statz
+		}
+	}
+
+	engine.failures = 0
+	engine.lastTabStats = stats
+	return stats
+}
+
+// failedTab records a failed poll of a tab and returns the last good
+// snapshot of it, if there is one, along with the error.
+func (engine *Engine) failedTab(tab Tab, err error) *Stats {
+	stats := engine.failedStats(err)
+	stats.Tab = tab
+
+	if last := engine.lastTabStats; last != nil && last.Tab == tab {
+		stats.Varz = last.Varz
+		stats.Routez = last.Routez
+		stats.Gatewayz = last.Gatewayz
+		stats.Leafz = last.Leafz
+		stats.Jsz = last.Jsz
+		stats.Accstatz = last.Accstatz
+		stats.Stale = true
+	}
+	return stats
+}
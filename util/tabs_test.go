@@ -0,0 +1,84 @@
+package toputils_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestFetchTabPollsItsEndpoints(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		varz.Name = "srv"
+		connz.Conns = []*server.ConnInfo{{Cid: 1}}
+	})
+	fm.statz = map[string]interface{}{
+		"/routez":   &server.Routez{NumRoutes: 1, Routes: []*server.RouteInfo{{Rid: 7, RemoteName: "other"}}},
+		"/gatewayz": &server.Gatewayz{Name: "east"},
+		"/leafz":    &server.Leafz{NumLeafs: 1, Leafs: []*server.LeafInfo{{ID: 3, Account: "A"}}},
+		"/jsz":      &server.JSInfo{Streams: 2},
+		"/accstatz": &server.AccountStatz{Accounts: []*server.AccountStat{{Account: "A", Conns: 4}}},
+	}
+
+	for _, tc := range []struct {
+		tab   top.Tab
+		paths []string
+		check func(stats *top.Stats) bool
+	}{
+		{top.TabServer, []string{"/varz"}, func(stats *top.Stats) bool { return stats.Varz.Name == "srv" }},
+		{top.TabConnections, []string{"/varz", "/connz"}, func(stats *top.Stats) bool { return len(stats.Connz.Conns) == 1 }},
+		{top.TabRoutes, []string{"/routez"}, func(stats *top.Stats) bool { return stats.Routez.Routes[0].Rid == 7 }},
+		{top.TabGateways, []string{"/gatewayz"}, func(stats *top.Stats) bool { return stats.Gatewayz.Name == "east" }},
+		{top.TabLeafs, []string{"/leafz"}, func(stats *top.Stats) bool { return stats.Leafz.Leafs[0].Account == "A" }},
+		{top.TabJetStream, []string{"/jsz"}, func(stats *top.Stats) bool { return stats.Jsz.Streams == 2 }},
+		{top.TabAccounts, []string{"/accstatz"}, func(stats *top.Stats) bool { return stats.Accstatz.Accounts[0].Conns == 4 }},
+	} {
+		t.Run(tc.tab.String(), func(t *testing.T) {
+			engine.SetTab(tc.tab)
+			fm.update(func(*server.Varz, *server.Connz) { fm.requested = nil })
+
+			stats := engine.FetchStatsSnapshot()
+			if stats.Stale || stats.RetryIn > 0 {
+				t.Fatalf("Expected the poll to succeed, got: %v", stats.Error)
+			}
+			if stats.Tab != tc.tab {
+				t.Fatalf("Expected stats of tab %s, got: %s", tc.tab, stats.Tab)
+			}
+			if !slices.Equal(fm.requested, tc.paths) {
+				t.Fatalf("Expected only %v to be polled, got: %v", tc.paths, fm.requested)
+			}
+			if !tc.check(stats) {
+				t.Fatalf("Unexpected stats: %+v", stats)
+			}
+		})
+	}
+}
+
+func TestFetchTabKeepsHistoryOfConnections(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	fm.statz = map[string]interface{}{"/routez": &server.Routez{NumRoutes: 1}}
+
+	engine.FetchStatsSnapshot()
+	last := engine.LastStats
+
+	engine.SetTab(top.TabRoutes)
+	engine.FetchStatsSnapshot()
+	if engine.LastStats != last {
+		t.Fatal("Expected the last stats of the connections to be kept")
+	}
+	if n := engine.History.Len(); n != 1 {
+		t.Fatalf("Expected only the connections poll in the history, got: %d", n)
+	}
+
+	// The last good poll of the tab is kept while failing
+	fm.update(func(*server.Varz, *server.Connz) { fm.fail = true })
+	stats := engine.FetchStatsSnapshot()
+	if !stats.Stale || stats.Routez == nil || stats.Routez.NumRoutes != 1 {
+		t.Fatalf("Expected the last routes as stale, got: %+v", stats)
+	}
+	if stats.Tab != top.TabRoutes || stats.RetryIn == 0 {
+		t.Fatalf("Expected a retry of the routes tab, got: %+v", stats)
+	}
+}
@@ -0,0 +1,163 @@
+package toputils
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// Level is how far a value is past its threshold.
+type Level int
+
+const (
+	LevelNormal Level = iota
+	LevelWarning
+	LevelCritical
+)
+
+// Threshold holds the values from which a value is at the warning and
+// critical levels, each one disabled when zero.
+type Threshold struct {
+	Warning  float64
+	Critical float64
+}
+
+// Level returns the level of a value.
+func (t Threshold) Level(v float64) Level {
+	switch {
+	case t.Critical > 0 && v >= t.Critical:
+		return LevelCritical
+	case t.Warning > 0 && v >= t.Warning:
+		return LevelWarning
+	}
+	return LevelNormal
+}
+
+// ThresholdMetric is a value that has a threshold.
+type ThresholdMetric string
+
+const (
+	// ThresholdPending is the pending bytes of a connection.
+	ThresholdPending ThresholdMetric = "pending"
+	// ThresholdIdle is the time since the last activity of a connection.
+	ThresholdIdle ThresholdMetric = "idle"
+	// ThresholdMsgs is the msgs per second to or from a connection.
+	ThresholdMsgs ThresholdMetric = "msgs"
+	// ThresholdRTT is the round trip time of a connection.
+	ThresholdRTT ThresholdMetric = "rtt"
+	// ThresholdCPU is the CPU usage of the server in percent.
+	ThresholdCPU ThresholdMetric = "cpu"
+	// ThresholdMem is the memory used by the server in bytes.
+	ThresholdMem ThresholdMetric = "mem"
+)
+
+// Thresholds are the thresholds of the metrics.
+type Thresholds map[ThresholdMetric]Threshold
+
+// DefaultThresholds returns the thresholds used unless others are set.
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		ThresholdPending: {Warning: mebibyte, Critical: 10 * mebibyte},
+		ThresholdIdle:    {Warning: (10 * time.Minute).Seconds(), Critical: time.Hour.Seconds()},
+		ThresholdRTT:     {Warning: DefaultHighRTT.Seconds(), Critical: time.Second.Seconds()},
+		ThresholdCPU:     {Warning: 70, Critical: 90},
+		ThresholdMem:     {Warning: gibibyte, Critical: 4 * gibibyte},
+	}
+}
+
+// ParseThresholds returns the thresholds with the ones of a comma separated
+// list of metric=warning[:critical] replaced, e.g. "pending=1MB:10MB,rtt=50ms".
+// Sizes can have a K, M or G suffix, durations are as time.ParseDuration
+// takes them, and a zero or missing level is disabled.
+func ParseThresholds(list string, thresholds Thresholds) (Thresholds, error) {
+	parsed := maps.Clone(thresholds)
+	if parsed == nil {
+		parsed = Thresholds{}
+	}
+	for _, entry := range strings.Split(list, ",") {
+		name, levels, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid threshold: %s", entry)
+		}
+
+		metric := ThresholdMetric(strings.ToLower(name))
+		var parse func(string) (float64, error)
+		switch metric {
+		case ThresholdPending, ThresholdMem:
+			parse = parseSize
+		case ThresholdIdle, ThresholdRTT:
+			parse = parseSeconds
+		case ThresholdMsgs, ThresholdCPU:
+			parse = func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }
+		default:
+			return nil, fmt.Errorf("invalid threshold metric: %s", name)
+		}
+
+		warning, critical, _ := strings.Cut(levels, ":")
+		var t Threshold
+		var err error
+		if t.Warning, err = parse(warning); err != nil {
+			return nil, fmt.Errorf("invalid %s threshold: %s", metric, warning)
+		}
+		if critical != "" {
+			if t.Critical, err = parse(critical); err != nil {
+				return nil, fmt.Errorf("invalid %s threshold: %s", metric, critical)
+			}
+		}
+		parsed[metric] = t
+	}
+	return parsed, nil
+}
+
+// parseSize parses a number of bytes with an optional K, M or G suffix,
+// e.g. 512K or 1.5MB, in multiples of 1024 as Psize displays them.
+func parseSize(s string) (float64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	unit := 1.0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = kibibyte
+	case strings.HasSuffix(s, "M"):
+		unit = mebibyte
+	case strings.HasSuffix(s, "G"):
+		unit = gibibyte
+	}
+	n, err := strconv.ParseFloat(strings.TrimRight(s, "KMG"), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return n * unit, nil
+}
+
+// parseSeconds parses a duration, or zero, as a number of seconds.
+func parseSeconds(s string) (float64, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	return d.Seconds(), nil
+}
+
+// ConnLevels returns the level of the columns of a connection with a
+// threshold, at the time of the snapshot the connection is from.
+func (t Thresholds) ConnLevels(conn *server.ConnInfo, rates *ConnRates, now time.Time) map[Column]Level {
+	levels := map[Column]Level{
+		ColumnPending: t[ThresholdPending].Level(float64(conn.Pending)),
+		ColumnRTT:     t[ThresholdRTT].Level(ParseRTT(conn.RTT).Seconds()),
+	}
+	if !conn.LastActivity.IsZero() {
+		levels[ColumnLast] = t[ThresholdIdle].Level(now.Sub(conn.LastActivity).Seconds())
+	}
+	if rates != nil {
+		levels[ColumnMsgsTo] = t[ThresholdMsgs].Level(rates.OutMsgsRate)
+		levels[ColumnMsgsFrom] = t[ThresholdMsgs].Level(rates.InMsgsRate)
+	}
+	return levels
+}
@@ -0,0 +1,101 @@
+package toputils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	top "github.com/nats-io/nats-top/util"
+)
+
+func TestThresholdLevel(t *testing.T) {
+	threshold := top.Threshold{Warning: 10, Critical: 100}
+	for v, want := range map[float64]top.Level{
+		0:   top.LevelNormal,
+		9.9: top.LevelNormal,
+		10:  top.LevelWarning,
+		99:  top.LevelWarning,
+		100: top.LevelCritical,
+		1e6: top.LevelCritical,
+	} {
+		if got := threshold.Level(v); got != want {
+			t.Fatalf("Expected level %d for %v, got: %d", want, v, got)
+		}
+	}
+
+	if got := (top.Threshold{Critical: 100}).Level(50); got != top.LevelNormal {
+		t.Fatalf("Expected no warning level when disabled, got: %d", got)
+	}
+	if got := (top.Threshold{}).Level(1e9); got != top.LevelNormal {
+		t.Fatalf("Expected disabled threshold, got: %d", got)
+	}
+}
+
+func TestParseThresholds(t *testing.T) {
+	defaults := top.DefaultThresholds()
+
+	thresholds, err := top.ParseThresholds("pending=512K:2MB, RTT=50ms, msgs=1000:5000.5, mem=1.5G:0, idle=0:2h", defaults)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for metric, want := range map[top.ThresholdMetric]top.Threshold{
+		top.ThresholdPending: {Warning: 512 * 1024, Critical: 2 * 1024 * 1024},
+		top.ThresholdRTT:     {Warning: 0.05},
+		top.ThresholdMsgs:    {Warning: 1000, Critical: 5000.5},
+		top.ThresholdMem:     {Warning: 1.5 * 1024 * 1024 * 1024},
+		top.ThresholdIdle:    {Critical: 7200},
+		top.ThresholdCPU:     defaults[top.ThresholdCPU],
+	} {
+		if got := thresholds[metric]; got != want {
+			t.Fatalf("Expected %s threshold %+v, got: %+v", metric, want, got)
+		}
+	}
+	if defaults[top.ThresholdRTT] == thresholds[top.ThresholdRTT] {
+		t.Fatal("Expected the default thresholds to be left as they were")
+	}
+
+	for _, list := range []string{"pending", "foo=1", "rtt=1", "pending=1X", "cpu=high", "mem=-1K", "idle=1m:soon"} {
+		if _, err := top.ParseThresholds(list, defaults); err == nil {
+			t.Fatalf("Expected an error parsing %q", list)
+		}
+	}
+}
+
+func TestConnLevels(t *testing.T) {
+	thresholds := top.Thresholds{
+		top.ThresholdPending: {Warning: 1024, Critical: 4096},
+		top.ThresholdIdle:    {Warning: 60, Critical: 600},
+		top.ThresholdRTT:     {Warning: 0.1},
+		top.ThresholdMsgs:    {Warning: 100, Critical: 1000},
+	}
+
+	now := time.Now()
+	conn := &server.ConnInfo{
+		Pending:      2048,
+		RTT:          "150ms",
+		LastActivity: now.Add(-time.Hour),
+	}
+	rates := &top.ConnRates{InMsgsRate: 5000, OutMsgsRate: 10}
+
+	levels := thresholds.ConnLevels(conn, rates, now)
+	for column, want := range map[top.Column]top.Level{
+		top.ColumnPending:  top.LevelWarning,
+		top.ColumnRTT:      top.LevelWarning,
+		top.ColumnLast:     top.LevelCritical,
+		top.ColumnMsgsFrom: top.LevelCritical,
+		top.ColumnMsgsTo:   top.LevelNormal,
+		top.ColumnName:     top.LevelNormal,
+	} {
+		if got := levels[column]; got != want {
+			t.Fatalf("Expected level %d for %s, got: %d", want, column, got)
+		}
+	}
+
+	// Connections without rates yet only have the other levels
+	levels = thresholds.ConnLevels(&server.ConnInfo{}, nil, now)
+	for column, level := range levels {
+		if level != top.LevelNormal {
+			t.Fatalf("Expected no level past a threshold, got %d for %s", level, column)
+		}
+	}
+}
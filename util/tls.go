@@ -0,0 +1,105 @@
+package toputils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions represents the settings used for polling the
+// monitoring endpoint via HTTPS.
+type TLSOptions struct {
+	CACert     string
+	Cert       string
+	Key        string
+	SkipVerify bool
+
+	// ServerName overrides the name used for SNI and for
+	// verifying the server certificate.
+	ServerName string
+
+	// MinVersion is the minimum accepted TLS version, e.g. tls.VersionTLS12.
+	MinVersion uint16
+
+	// SystemRoots trusts the system root CAs in addition to CACert.
+	SystemRoots bool
+}
+
+// ParseTLSVersion takes a version such as "1.2" and returns
+// the matching crypto/tls constant.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid TLS version %q", version)
+	}
+}
+
+// certReloader serves a client certificate and loads it again whenever
+// the certificate or key files change, so that long running sessions
+// survive certificate rotation.
+type certReloader struct {
+	sync.Mutex
+	certFile    string
+	keyFile     string
+	certModTime time.Time
+	keyModTime  time.Time
+	cert        *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the keypair if the files were modified since the last load.
+func (r *certReloader) reload() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if r.cert != nil && certInfo.ModTime().Equal(r.certModTime) && keyInfo.ModTime().Equal(r.keyModTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+
+	return nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+// If the files can't be loaded, e.g. while they are being rotated,
+// the previous certificate keeps being used.
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.reload()
+
+	return r.cert, nil
+}
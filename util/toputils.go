@@ -9,6 +9,9 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats-server/v2/server"
@@ -16,21 +19,85 @@ import (
 
 const DisplaySubscriptions = 1
 
+// DefaultTimeout is the default time limit for a single monitoring request.
+const DefaultTimeout = 5 * time.Second
+
+// DefaultMaxBackoff is the default upper bound for the delay between
+// polls after consecutive failures.
+const DefaultMaxBackoff = 30 * time.Second
+
+// MinInterval is the shortest refresh interval, so that the monitoring
+// endpoint isn't polled in a busy loop.
+const MinInterval = 100 * time.Millisecond
+
 type Engine struct {
-	Host         string
-	Port         int
-	HttpClient   *http.Client
-	Uri          string
-	Conns        int
-	SortOpt      server.SortOpt
-	Delay        int
-	DisplaySubs  bool
-	StatsCh      chan *Stats
-	ShutdownCh   chan struct{}
-	LastStats    *Stats
-	LastPollTime time.Time
-	ShowRates    bool
-	LastConnz    map[uint64]*server.ConnInfo
+	Host          string
+	Port          int
+	HttpClient    *http.Client
+	Uri           string
+	Conns         int
+	SortOpt       server.SortOpt
+	SortDirection Direction
+	Delay         int
+	Timeout       time.Duration
+	MaxBackoff    time.Duration
+	DisplaySubs   bool
+	StatsCh       chan *Stats
+	ShutdownCh    chan struct{}
+	LastStats     *Stats
+	LastPollTime  time.Time
+	ShowRates     bool
+	LastConnz     map[uint64]*server.ConnInfo
+	LastRestart   time.Time
+	History       *History
+
+	// failures is the number of consecutive failed polls.
+	failures int
+
+	// recentConnected and recentDisconnected are the last
+	// clients that came and went, newest first.
+	recentConnected    []ConnEvent
+	recentDisconnected []ConnEvent
+
+	// noServerRTTSort is set once the server rejected sorting by rtt,
+	// as older servers do, so connections are sorted by it here instead.
+	noServerRTTSort bool
+
+	// The fields below are set through their setters from the UI while
+	// MonitorStats is polling, hence atomic. A change that needs other
+	// stats than the last ones makes it poll right away through pollNow,
+	// and the others apply from the next poll on.
+
+	// detailCid is the CID of the connection whose detail is requested
+	// on every poll.
+	detailCid atomic.Uint64
+
+	// sort is the sort option and direction overriding SortOpt and
+	// SortDirection.
+	sort atomic.Pointer[connzSort]
+
+	// filter is the filter of the displayed connections, or nil if
+	// there is none.
+	filter atomic.Pointer[ConnFilter]
+
+	// accounts is set while the accounts of the connections are
+	// displayed, which the server only reports with auth.
+	accounts atomic.Bool
+
+	// tab is the tab whose endpoints are polled, and lastTabStats the
+	// last good poll of a tab other than the connections one.
+	tab          atomic.Int32
+	lastTabStats *Stats
+
+	// pollNow makes MonitorStats poll right away instead of waiting
+	// for the next refresh, e.g. once the tab changed.
+	pollNow chan struct{}
+
+	// interval is the refresh interval overriding Delay, and
+	// intervalChanged makes MonitorStats wait for the new one instead
+	// of the previous one.
+	interval        atomic.Int64
+	intervalChanged chan struct{}
 }
 
 func NewEngine(host string, port int, conns int, delay int) *Engine {
@@ -39,14 +106,20 @@ func NewEngine(host string, port int, conns int, delay int) *Engine {
 		Port:       port,
 		Conns:      conns,
 		Delay:      delay,
+		Timeout:    DefaultTimeout,
+		MaxBackoff: DefaultMaxBackoff,
 		StatsCh:    make(chan *Stats),
 		ShutdownCh: make(chan struct{}),
 		LastConnz:  make(map[uint64]*server.ConnInfo),
+		History:    NewHistory(DefaultHistorySize, 0),
+		pollNow:    make(chan struct{}, 1),
+
+		intervalChanged: make(chan struct{}, 1),
 	}
 }
 
 // Request takes a path and options, and returns a Stats struct
-// with with either connz or varz
+// with the statz of the endpoint, e.g. connz or varz
 func (engine *Engine) Request(path string) (interface{}, error) {
 	var statz interface{}
 
@@ -56,63 +129,186 @@ func (engine *Engine) Request(path string) (interface{}, error) {
 		statz = &server.Varz{}
 	case "/connz":
 		statz = &server.Connz{}
-		uri += fmt.Sprintf("?limit=%d&sort=%s", engine.Conns, engine.SortOpt)
-		if engine.DisplaySubs {
+		uri += fmt.Sprintf("?limit=%d&sort=%s", engine.Conns, engine.connzSortOpt())
+		// The accounts of the connections are only reported with auth,
+		// needed for filtering connections by them too
+		if engine.accounts.Load() || engine.Filter() != nil {
+			uri += "&auth=true"
+		}
+		// Subscriptions are needed for filtering connections by them too
+		if engine.DisplaySubs || engine.Filter() != nil {
 			uri += fmt.Sprintf("&subs=%d", DisplaySubscriptions)
 		}
+	case "/routez":
+		statz = &server.Routez{}
+	case "/gatewayz":
+		statz = &server.Gatewayz{}
+	case "/leafz":
+		statz = &server.Leafz{}
+	case "/jsz":
+		statz = &server.JSInfo{}
+		uri += "?accounts=true"
+	case "/accstatz":
+		statz = &server.AccountStatz{}
+		uri += "?unused=true"
 	default:
 		return nil, fmt.Errorf("invalid path '%s' for stats server", path)
 	}
 
+	status, body, err := engine.get(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == http.StatusBadRequest && path == "/connz" && engine.connzSortOpt() == server.ByRTT &&
+		bytes.Contains(body, []byte("invalid sorting option")) {
+		engine.noServerRTTSort = true
+		return engine.Request(path)
+	}
+
+	if err := decodeStatz(status, body, &statz); err != nil {
+		return nil, err
+	}
+
+	return statz, nil
+}
+
+// get requests uri from the monitoring endpoint and returns
+// the status code and body of the response.
+func (engine *Engine) get(uri string) (int, []byte, error) {
 	resp, err := engine.HttpClient.Get(uri)
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 	if err != nil {
-		return nil, fmt.Errorf("could not get stats from server: %w", err)
+		return 0, nil, fmt.Errorf("could not get stats from server: %w", err)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("could not read response body: %w", err)
+		return 0, nil, fmt.Errorf("could not read response body: %w", err)
 	}
+	return resp.StatusCode, body, nil
+}
 
-	if resp.StatusCode != 200 {
+// decodeStatz unmarshals the body of a successful response into statz.
+func decodeStatz(status int, body []byte, statz interface{}) error {
+	if status != 200 {
 		end := bytes.IndexAny(body, "\r\n")
-		if end > 80 {
-			end = 80
+		if end < 0 || end > 80 {
+			end = min(len(body), 80)
 		}
-		return nil, fmt.Errorf("stats request failed %d: %q", resp.StatusCode, string(body[:end]))
+		return fmt.Errorf("stats request failed %d: %q", status, string(body[:end]))
 	}
 
-	err = json.Unmarshal(body, &statz)
-	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal statz json: %w", err)
+	if err := json.Unmarshal(body, statz); err != nil {
+		return fmt.Errorf("could not unmarshal statz json: %w", err)
 	}
-
-	return statz, nil
+	return nil
 }
 
 // MonitorStats is ran as a goroutine and takes options
 // which can modify how poll values then sends to channel.
+// After a failed poll the next one is delayed with an exponential
+// backoff, capped by MaxBackoff. Changing the tab polls it right away,
+// and changing the refresh interval restarts the wait for the next poll.
 func (engine *Engine) MonitorStats() error {
 	// Initial fetch.
 	engine.StatsCh <- engine.fetchStats()
 
-	delay := time.Duration(engine.Delay) * time.Second
-	ticker := time.NewTicker(delay)
-	defer ticker.Stop()
+	timer := time.NewTimer(engine.nextPollDelay())
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-engine.ShutdownCh:
 			return nil
-		case <-ticker.C:
+		case <-timer.C:
+			engine.StatsCh <- engine.fetchStats()
+			timer.Reset(engine.nextPollDelay())
+		case <-engine.pollNow:
 			engine.StatsCh <- engine.fetchStats()
+			timer.Reset(engine.nextPollDelay())
+		case <-engine.intervalChanged:
+			// A timer that fired meanwhile doesn't poll once reset
+			timer.Reset(engine.nextPollDelay())
 		}
 	}
 }
 
+// nextPollDelay returns how long to wait before the next poll, which is
+// the refresh interval unless the previous polls failed.
+func (engine *Engine) nextPollDelay() time.Duration {
+	if engine.failures > 0 {
+		return engine.retryDelay()
+	}
+	return engine.Interval()
+}
+
+// requestPoll makes MonitorStats poll right away, if it is running and
+// not about to already.
+func (engine *Engine) requestPoll() {
+	select {
+	case engine.pollNow <- struct{}{}:
+	default:
+	}
+}
+
+// Interval returns the refresh interval, which is Delay seconds
+// unless another one was set, and at least MinInterval.
+func (engine *Engine) Interval() time.Duration {
+	if interval := engine.interval.Load(); interval > 0 {
+		return max(time.Duration(interval), MinInterval)
+	}
+	return max(time.Duration(engine.Delay)*time.Second, MinInterval)
+}
+
+// SetInterval changes the refresh interval, overriding Delay.
+func (engine *Engine) SetInterval(interval time.Duration) {
+	engine.interval.Store(int64(interval))
+	select {
+	case engine.intervalChanged <- struct{}{}:
+	default:
+	}
+}
+
+// ParseInterval parses a refresh interval as a duration, e.g. 500ms or 5s,
+// or as a number of seconds like -d takes it, of at least MinInterval.
+func ParseInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	// A number of seconds is parsed as a duration too, so it cannot overflow
+	duration := s
+	if _, nerr := strconv.Atoi(s); nerr == nil {
+		duration += "s"
+	}
+	interval, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval: %s", s)
+	}
+	if interval < MinInterval {
+		return 0, fmt.Errorf("interval must be at least %s: %s", MinInterval, s)
+	}
+	return interval, nil
+}
+
+// retryDelay doubles the refresh interval for every consecutive
+// failure after the first one, up to MaxBackoff.
+func (engine *Engine) retryDelay() time.Duration {
+	delay := engine.Interval()
+	maxDelay := engine.MaxBackoff
+	if maxDelay < delay {
+		maxDelay = delay
+	}
+
+	for i := 1; i < engine.failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
 func (engine *Engine) FetchStatsSnapshot() *Stats {
 	return engine.fetchStats()
 }
@@ -120,6 +316,10 @@ func (engine *Engine) FetchStatsSnapshot() *Stats {
 var errDud = fmt.Errorf("")
 
 func (engine *Engine) fetchStats() *Stats {
+	if tab := engine.CurrentTab(); tab != TabConnections {
+		return engine.fetchTab(tab)
+	}
+
 	var inMsgsDelta int64
 	var outMsgsDelta int64
 	var inBytesDelta int64
@@ -146,8 +346,7 @@ func (engine *Engine) fetchStats() *Stats {
 	{
 		result, err := engine.Request("/varz")
 		if err != nil {
-			stats.Error = err
-			return stats
+			return engine.failedStats(err)
 		}
 
 		if varz, ok := result.(*server.Varz); ok {
@@ -159,14 +358,44 @@ func (engine *Engine) fetchStats() *Stats {
 	{
 		result, err := engine.Request("/connz")
 		if err != nil {
-			stats.Error = err
-			return stats
+			return engine.failedStats(err)
 		}
 
 		if connz, ok := result.(*server.Connz); ok {
 			stats.Connz = connz
 		}
+		// The credentials reported with auth are not kept in the history
+		for _, conn := range stats.Connz.Conns {
+			conn.JWT = ""
+			conn.IssuerKey = ""
+		}
+		sortOpt, sortDirection := engine.Sort()
+		if sortOpt == server.ByRTT && engine.noServerRTTSort {
+			sortConnsByRTT(stats.Connz.Conns)
+		}
+		if sortDirection != DirectionDefault {
+			column, desc := SortOrder(sortOpt, sortDirection)
+			stats.Connz.Conns = OrderConns(stats, column, desc, false, 0)
+		}
+	}
+
+	if cid := engine.FollowedConn(); cid != 0 {
+		stats.Detail = engine.RequestConn(cid)
+		// Only the issuer key of the followed connection is displayed
+		if conn := stats.Detail.Conn; conn != nil {
+			conn.JWT = ""
+		}
+	}
+
+	// Counters start over when the server restarts, so the
+	// previous poll can't be used as the baseline for rates.
+	if engine.LastStats != nil && serverRestarted(engine.LastStats.Varz, stats.Varz) {
+		engine.LastStats = nil
+		engine.LastConnz = make(map[uint64]*server.ConnInfo)
+		engine.LastRestart = time.Now()
+		stats.Restarted = true
 	}
+	stats.LastRestart = engine.LastRestart
 
 	var isFirstTime bool
 	if engine.LastStats != nil {
@@ -201,23 +430,36 @@ func (engine *Engine) fetchStats() *Stats {
 	}
 
 	// Calculate rates but the first time
+	var elapsed, connsElapsed time.Duration
 	if !isFirstTime {
-		tdelta := stats.Varz.Now.Sub(engine.LastStats.Varz.Now)
-
-		inMsgsRate = float64(inMsgsDelta) / tdelta.Seconds()
-		outMsgsRate = float64(outMsgsDelta) / tdelta.Seconds()
-		inBytesRate = float64(inBytesDelta) / tdelta.Seconds()
-		outBytesRate = float64(outBytesDelta) / tdelta.Seconds()
+		elapsed = stats.Varz.Now.Sub(engine.LastStats.Varz.Now)
+		connsElapsed = stats.Connz.Now.Sub(engine.LastStats.Connz.Now)
+	}
+	if elapsed > 0 {
+		inMsgsRate = float64(inMsgsDelta) / elapsed.Seconds()
+		outMsgsRate = float64(outMsgsDelta) / elapsed.Seconds()
+		inBytesRate = float64(inBytesDelta) / elapsed.Seconds()
+		outBytesRate = float64(outBytesDelta) / elapsed.Seconds()
 	}
 	rates := &Rates{
 		InMsgsRate:   inMsgsRate,
 		OutMsgsRate:  outMsgsRate,
 		InBytesRate:  inBytesRate,
 		OutBytesRate: outBytesRate,
+		Elapsed:      elapsed,
+		ConnsElapsed: connsElapsed,
 		Connections:  make(map[uint64]*ConnRates),
 	}
 
-	// Measure per connection metrics.
+	// Smooth the rates, once there is a previous poll to compare with.
+	var lastRates *Rates
+	if elapsed > 0 {
+		lastRates = engine.LastStats.Rates
+		rates.Averages = lastRates.Averages.next(inMsgsRate, outMsgsRate, inBytesRate, outBytesRate, elapsed)
+	}
+
+	// Measure per connection metrics using the time between
+	// both /connz responses as reported by the server.
 	for cid, conn := range connz {
 		cr := &ConnRates{
 			InMsgsRate:   0,
@@ -226,52 +468,148 @@ func (engine *Engine) fetchStats() *Stats {
 			OutBytesRate: 0,
 		}
 		lconn, wasConnected := engine.LastConnz[cid]
-		if wasConnected {
-			cr.InMsgsRate = float64(conn.InMsgs - lconn.InMsgs)
-			cr.OutMsgsRate = float64(conn.OutMsgs - lconn.OutMsgs)
-			cr.InBytesRate = float64(conn.InBytes - lconn.InBytes)
-			cr.OutBytesRate = float64(conn.OutBytes - lconn.OutBytes)
+		if wasConnected && connsElapsed > 0 && !connReset(lconn, conn) {
+			secs := connsElapsed.Seconds()
+			cr.InMsgsRate = float64(conn.InMsgs-lconn.InMsgs) / secs
+			cr.OutMsgsRate = float64(conn.OutMsgs-lconn.OutMsgs) / secs
+			cr.InBytesRate = float64(conn.InBytes-lconn.InBytes) / secs
+			cr.OutBytesRate = float64(conn.OutBytes-lconn.OutBytes) / secs
+
+			var lcr ConnRates
+			if lastRates != nil && lastRates.Connections[cid] != nil {
+				lcr = *lastRates.Connections[cid]
+			}
+			cr.Averages = lcr.Averages.next(cr.InMsgsRate, cr.OutMsgsRate, cr.InBytesRate, cr.OutBytesRate, connsElapsed)
+			cr.Pending = lcr.Pending.next(lconn.Pending, conn.Pending, engine.LastStats.Connz.Now, stats.Connz.Now, stats.Varz.MaxPending)
 		}
 		rates.Connections[cid] = cr
 	}
 
 	stats.Rates = rates
 
+	if !isFirstTime {
+		stats.Churn = engine.trackChurn(stats.Connz, connz, connsElapsed)
+	}
+
 	// Snapshot stats.
+	engine.failures = 0
 	engine.LastStats = stats
 	engine.LastPollTime = time.Now()
 	engine.LastConnz = connz
+	engine.History.Add(stats)
+
+	return stats
+}
+
+// serverRestarted reports whether the server was restarted or replaced
+// by another one since the last poll, detected by a change of server ID,
+// the uptime going backwards or any of the counters decreasing.
+func serverRestarted(last, cur *server.Varz) bool {
+	switch {
+	case last.ID != cur.ID:
+		return true
+	case cur.Now.Sub(cur.Start) < last.Now.Sub(last.Start):
+		return true
+	case cur.InMsgs < last.InMsgs || cur.OutMsgs < last.OutMsgs:
+		return true
+	case cur.InBytes < last.InBytes || cur.OutBytes < last.OutBytes:
+		return true
+	}
+	return false
+}
+
+// connReset reports whether a connection can't be compared with its
+// previous poll, because the CID was reused by another connection
+// or its counters decreased.
+func connReset(last, cur *server.ConnInfo) bool {
+	switch {
+	case !cur.Start.Equal(last.Start):
+		return true
+	case cur.InMsgs < last.InMsgs || cur.OutMsgs < last.OutMsgs:
+		return true
+	case cur.InBytes < last.InBytes || cur.OutBytes < last.OutBytes:
+		return true
+	}
+	return false
+}
+
+// failedStats records a failed poll and returns the last good snapshot,
+// if there is one, along with the error and the delay until the retry.
+func (engine *Engine) failedStats(err error) *Stats {
+	engine.failures++
+
+	stats := &Stats{
+		Varz:    &server.Varz{},
+		Connz:   &server.Connz{},
+		Rates:   &Rates{},
+		Error:   err,
+		RetryIn: engine.retryDelay(),
+
+		LastRestart: engine.LastRestart,
+	}
+	if engine.LastStats != nil {
+		stats.Varz = engine.LastStats.Varz
+		stats.Connz = engine.LastStats.Connz
+		stats.Rates = engine.LastStats.Rates
+		stats.Detail = engine.LastStats.Detail
+		stats.Stale = true
+	}
 
 	return stats
 }
 
 // SetupHTTPS sets up the http client and uri to use for polling.
 func (engine *Engine) SetupHTTPS(caCertOpt, certOpt, keyOpt string, skipVerifyOpt bool) error {
-	tlsConfig := &tls.Config{}
-	if caCertOpt != "" {
-		caCert, err := os.ReadFile(caCertOpt)
-		if err != nil {
-			return err
-		}
+	return engine.SetupHTTPSWithOptions(&TLSOptions{
+		CACert:     caCertOpt,
+		Cert:       certOpt,
+		Key:        keyOpt,
+		SkipVerify: skipVerifyOpt,
+	})
+}
+
+// SetupHTTPSWithOptions sets up the http client and uri to use for
+// polling using the extended TLS options.
+func (engine *Engine) SetupHTTPSWithOptions(opts *TLSOptions) error {
+	tlsConfig := &tls.Config{
+		ServerName: opts.ServerName,
+		MinVersion: opts.MinVersion,
+	}
+
+	if opts.CACert != "" || opts.SystemRoots {
 		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
+		if opts.SystemRoots {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				return fmt.Errorf("could not load system root CAs: %w", err)
+			}
+			caCertPool = systemPool
+		}
+
+		if opts.CACert != "" {
+			caCert, err := os.ReadFile(opts.CACert)
+			if err != nil {
+				return err
+			}
+			caCertPool.AppendCertsFromPEM(caCert)
+		}
 		tlsConfig.RootCAs = caCertPool
 	}
 
-	if certOpt != "" && keyOpt != "" {
-		cert, err := tls.LoadX509KeyPair(certOpt, keyOpt)
+	if opts.Cert != "" && opts.Key != "" {
+		reloader, err := newCertReloader(opts.Cert, opts.Key)
 		if err != nil {
 			return err
 		}
-		tlsConfig.Certificates = []tls.Certificate{cert}
+		tlsConfig.GetClientCertificate = reloader.GetClientCertificate
 	}
 
-	if skipVerifyOpt {
+	if opts.SkipVerify {
 		tlsConfig.InsecureSkipVerify = true
 	}
 
 	transport := &http.Transport{TLSClientConfig: tlsConfig}
-	engine.HttpClient = &http.Client{Transport: transport}
+	engine.HttpClient = &http.Client{Transport: transport, Timeout: engine.Timeout}
 	engine.Uri = fmt.Sprintf("https://%s:%d", engine.Host, engine.Port)
 
 	return nil
@@ -279,7 +617,7 @@ func (engine *Engine) SetupHTTPS(caCertOpt, certOpt, keyOpt string, skipVerifyOp
 
 // SetupHTTP sets up the http client and uri to use for polling.
 func (engine *Engine) SetupHTTP() {
-	engine.HttpClient = &http.Client{}
+	engine.HttpClient = &http.Client{Timeout: engine.Timeout}
 	engine.Uri = fmt.Sprintf("http://%s:%d", engine.Host, engine.Port)
 }
 
@@ -289,6 +627,37 @@ type Stats struct {
 	Connz *server.Connz
 	Rates *Rates
 	Error error
+
+	// RetryIn is set when the poll failed and holds the delay
+	// until the next attempt.
+	RetryIn time.Duration
+
+	// Stale is set when the poll failed and the monitored data
+	// is the last one that was successfully fetched.
+	Stale bool
+
+	// Restarted is set when a server restart was detected in this poll,
+	// and LastRestart holds when the last one was detected.
+	Restarted   bool
+	LastRestart time.Time
+
+	// Churn holds the connections that came and went since the
+	// previous poll, or nil if there was no previous poll.
+	Churn *Churn
+
+	// Detail holds the detail of the connection followed by the engine,
+	// or nil if there is none.
+	Detail *ConnDetail
+
+	// Tab is the tab the stats were polled for. The ones of the other tabs
+	// than the connections one only hold what their endpoints returned,
+	// and the statz of the endpoints not polled are nil.
+	Tab      Tab
+	Routez   *server.Routez
+	Gatewayz *server.Gatewayz
+	Leafz    *server.Leafz
+	Jsz      *server.JSInfo
+	Accstatz *server.AccountStatz
 }
 
 // Rates represents the tracked in/out msgs and bytes flow
@@ -299,6 +668,15 @@ type Rates struct {
 	InBytesRate  float64
 	OutBytesRate float64
 	Connections  map[uint64]*ConnRates
+
+	// Elapsed is the time between the last two /varz responses
+	// and ConnsElapsed the one between the last two /connz responses,
+	// both measured by the server. They are zero on the first poll.
+	Elapsed      time.Duration
+	ConnsElapsed time.Duration
+
+	// Averages are the rates smoothed over the 1, 5 and 15 minute windows.
+	Averages RateAverages
 }
 
 type ConnRates struct {
@@ -306,6 +684,8 @@ type ConnRates struct {
 	OutMsgsRate  float64
 	InBytesRate  float64
 	OutBytesRate float64
+	Averages     RateAverages
+	Pending      PendingTrend
 }
 
 const kibibyte = 1024
@@ -353,3 +733,46 @@ func Nsize(displayRawValue bool, s int64) string {
 		return fmt.Sprintf("%.1fT", size/t)
 	}
 }
+
+var sparks = []rune{'▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
+
+// Sparkline takes a series of values and returns a chart of at most width
+// characters, scaled from zero to the largest value. Longer series are
+// divided in width buckets which are averaged.
+func Sparkline(values []float64, width int) string {
+	if width <= 0 || len(values) == 0 {
+		return ""
+	}
+
+	if len(values) > width {
+		buckets := make([]float64, width)
+		for i := range buckets {
+			from := i * len(values) / width
+			to := (i + 1) * len(values) / width
+
+			var sum float64
+			for _, v := range values[from:to] {
+				sum += v
+			}
+			buckets[i] = sum / float64(to-from)
+		}
+		values = buckets
+	}
+
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+
+	chart := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if max > 0 && v > 0 {
+			level = int(v / max * float64(len(sparks)-1))
+		}
+		chart[i] = sparks[level]
+	}
+	return string(chart)
+}
@@ -1,10 +1,18 @@
 package toputils_test
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -27,6 +35,127 @@ func resetPreviousHTTPConnections() {
 	http.DefaultTransport = &http.Transport{}
 }
 
+// fakeMonitor serves /varz and /connz responses that tests can change between polls,
+// and the ones of the other endpoints set in statz.
+type fakeMonitor struct {
+	sync.Mutex
+	varz  *server.Varz
+	connz *server.Connz
+	statz map[string]interface{}
+	fail  bool
+
+	// requested are the paths of the requests served so far.
+	requested []string
+
+	// rejectSort is a sort option for connections the server doesn't know.
+	rejectSort server.SortOpt
+
+	// onRequest is called with the query of every /connz request.
+	onRequest func(query string)
+}
+
+func (fm *fakeMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fm.Lock()
+	defer fm.Unlock()
+
+	fm.requested = append(fm.requested, r.URL.Path)
+	if fm.fail {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	var v interface{}
+	switch r.URL.Path {
+	case "/varz":
+		v = fm.varz
+	case "/connz":
+		if sort := server.SortOpt(r.URL.Query().Get("sort")); sort != "" && sort == fm.rejectSort {
+			http.Error(w, fmt.Sprintf("invalid sorting option: %s", sort), http.StatusBadRequest)
+			return
+		}
+		if fm.onRequest != nil {
+			fm.onRequest(r.URL.RawQuery)
+		}
+		v = fm.connz
+		if cid := r.URL.Query().Get("cid"); cid != "" {
+			connz := &server.Connz{Now: fm.connz.Now}
+			for _, conn := range fm.connz.Conns {
+				if fmt.Sprint(conn.Cid) == cid {
+					connz.Conns = append(connz.Conns, conn)
+				}
+			}
+			v = connz
+		}
+	default:
+		statz, ok := fm.statz[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		v = statz
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// update changes the served responses under the lock.
+func (fm *fakeMonitor) update(f func(varz *server.Varz, connz *server.Connz)) {
+	fm.Lock()
+	defer fm.Unlock()
+	f(fm.varz, fm.connz)
+}
+
+// runFakeMonitor starts a fake monitoring endpoint and returns
+// an engine that polls it.
+func runFakeMonitor(t *testing.T) (*fakeMonitor, *top.Engine) {
+	t.Helper()
+
+	now := time.Now()
+	fm := &fakeMonitor{
+		varz:  &server.Varz{ID: "SRV", Now: now},
+		connz: &server.Connz{Now: now},
+	}
+	ts := httptest.NewServer(fm)
+	t.Cleanup(ts.Close)
+
+	addr := strings.TrimPrefix(ts.URL, "http://")
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("Could not parse test server address %q: %v", addr, err)
+	}
+
+	var port int
+	fmt.Sscanf(portStr, "%d", &port)
+
+	engine := top.NewEngine(host, port, 10, 1)
+	engine.SetupHTTP()
+	return fm, engine
+}
+
+// runMonitorStats runs the polling loop of the engine until the end of the
+// test, when it is shut down and its last stats are drained so that it exits.
+func runMonitorStats(t *testing.T, engine *top.Engine) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := engine.MonitorStats(); err != nil {
+			t.Errorf("Expected no error from the monitoring loop, got: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		close(engine.ShutdownCh)
+		for {
+			select {
+			case <-engine.StatsCh:
+			case <-done:
+				return
+			}
+		}
+	})
+}
+
 // retryUntil keeps calling the function f until it returns true or the deadline d has been reached.
 func retryUntil(d time.Duration, f func() bool) bool {
 	deadline := time.Now().Add(d)
@@ -443,3 +572,476 @@ func TestMonitoringTLSConnectionUsingCertsAndInsecure(t *testing.T) {
 		t.Fatalf("Timed out polling /varz via https")
 	}
 }
+
+func TestRequestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	engine := top.NewEngine("", 0, 10, 1)
+	engine.Timeout = 100 * time.Millisecond
+	engine.SetupHTTP()
+	engine.Uri = ts.URL
+
+	start := time.Now()
+	_, err := engine.Request("/varz")
+	if err == nil {
+		t.Fatal("Expected request to a hung server to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Expected request to time out after %v, took %v", engine.Timeout, elapsed)
+	}
+}
+
+func TestFetchStatsKeepsLastSnapshotOnFailure(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		varz.InMsgs = 10
+	})
+
+	engine.MaxBackoff = 3 * time.Second
+
+	stats := engine.FetchStatsSnapshot()
+	if stats.Stale || stats.RetryIn != 0 {
+		t.Fatalf("Expected fresh stats, got stale: %v, retry in: %v", stats.Stale, stats.RetryIn)
+	}
+
+	fm.update(func(*server.Varz, *server.Connz) { fm.fail = true })
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		stats = engine.FetchStatsSnapshot()
+		if stats.Error == nil || stats.Error.Error() == "" {
+			t.Fatal("Expected stats to carry the request error")
+		}
+		if !stats.Stale {
+			t.Fatal("Expected stats to be flagged as stale")
+		}
+		if stats.Varz.ID != "SRV" || stats.Varz.InMsgs != 10 {
+			t.Fatalf("Expected last good snapshot to be kept, got: %+v", stats.Varz)
+		}
+		if stats.RetryIn != want {
+			t.Fatalf("Expected retry in %v, got: %v", want, stats.RetryIn)
+		}
+	}
+
+	fm.update(func(*server.Varz, *server.Connz) { fm.fail = false })
+	stats = engine.FetchStatsSnapshot()
+	if stats.Stale || stats.RetryIn != 0 {
+		t.Fatalf("Expected fresh stats after recovering, got stale: %v, retry in: %v", stats.Stale, stats.RetryIn)
+	}
+}
+
+func TestSetInterval(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+	engine.Delay = 3600
+	if got := engine.Interval(); got != time.Hour {
+		t.Fatalf("Expected the interval to be Delay seconds, got: %v", got)
+	}
+
+	runMonitorStats(t, engine)
+
+	select {
+	case <-engine.StatsCh:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the initial poll")
+	}
+
+	// The poll an hour away is replaced by one after the new interval
+	engine.SetInterval(200 * time.Millisecond)
+	if got := engine.Interval(); got != 200*time.Millisecond {
+		t.Fatalf("Expected the new interval, got: %v", got)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-engine.StatsCh:
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for a poll after the interval changed")
+		}
+	}
+
+	// Retries back off from the new interval too
+	fm.update(func(*server.Varz, *server.Connz) { fm.fail = true })
+	select {
+	case stats := <-engine.StatsCh:
+		if stats.RetryIn != 200*time.Millisecond {
+			t.Fatalf("Expected retry in the new interval, got: %v", stats.RetryIn)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for a failed poll")
+	}
+}
+
+func TestIntervalIsBounded(t *testing.T) {
+	// A non positive -d does not poll the server back to back
+	for _, delay := range []int{0, -1} {
+		engine := top.NewEngine("127.0.0.1", 8222, 10, delay)
+		if got := engine.Interval(); got != top.MinInterval {
+			t.Fatalf("Expected the interval of -d %d to be %v, got: %v", delay, top.MinInterval, got)
+		}
+	}
+
+	engine := top.NewEngine("127.0.0.1", 8222, 10, 1)
+	engine.SetInterval(time.Millisecond)
+	if got := engine.Interval(); got != top.MinInterval {
+		t.Fatalf("Expected the interval to be at least %v, got: %v", top.MinInterval, got)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  time.Duration
+		err   bool
+	}{
+		{"500ms", 500 * time.Millisecond, false},
+		{" 5s ", 5 * time.Second, false},
+		{"1m30s", 90 * time.Second, false},
+		{"2", 2 * time.Second, false},
+		{"100ms", top.MinInterval, false},
+		{"10ms", 0, true},
+		{"0", 0, true},
+		{"-1s", 0, true},
+		{"", 0, true},
+		{"fast", 0, true},
+		{"9999999999999", 0, true},
+		{"-9999999999999", 0, true},
+	} {
+		got, err := top.ParseInterval(tc.input)
+		if (err != nil) != tc.err {
+			t.Fatalf("ParseInterval(%q) error = %v, expected error: %v", tc.input, err, tc.err)
+		}
+		if got != tc.want {
+			t.Fatalf("ParseInterval(%q) = %v, expected %v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestMonitoringTLSConnectionUsingServerName(t *testing.T) {
+	srv, _ := server_test.RunServerWithConfig("./test/tls.conf")
+	defer srv.Shutdown()
+
+	host := srv.MonitorAddr().IP.String()
+	port := srv.MonitorAddr().Port
+
+	engine := top.NewEngine(host, port, 10, 1)
+	err := engine.SetupHTTPSWithOptions(&top.TLSOptions{
+		CACert:      "./test/ca.pem",
+		ServerName:  "localhost",
+		MinVersion:  tls.VersionTLS12,
+		SystemRoots: true,
+	})
+	if err != nil {
+		t.Fatalf("Expected to be able to configure polling via HTTPS. Got: %s", err)
+	}
+
+	if _, err := engine.Request("/varz"); err != nil {
+		t.Fatalf("Expected to poll /varz via https using server name. Got: %s", err)
+	}
+
+	engine = top.NewEngine(host, port, 10, 1)
+	err = engine.SetupHTTPSWithOptions(&top.TLSOptions{
+		CACert:     "./test/ca.pem",
+		ServerName: "nats.example.com",
+	})
+	if err != nil {
+		t.Fatalf("Expected to be able to configure polling via HTTPS. Got: %s", err)
+	}
+
+	if _, err := engine.Request("/varz"); err == nil {
+		t.Fatal("Expected certificate verification to fail for mismatched server name")
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	testcases := map[string]uint16{
+		"":    0,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+	for input, want := range testcases {
+		got, err := top.ParseTLSVersion(input)
+		if err != nil {
+			t.Fatalf("Expected to parse %q, got: %v", input, err)
+		}
+		if got != want {
+			t.Errorf("Expected %x for %q, got: %x", want, input, got)
+		}
+	}
+
+	if _, err := top.ParseTLSVersion("1.4"); err == nil {
+		t.Fatal("Expected error for unknown TLS version")
+	}
+}
+
+func TestClientCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	copyFile := func(src, dst string) {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("Could not read %s: %v", src, err)
+		}
+		if err := os.WriteFile(dst, data, 0600); err != nil {
+			t.Fatalf("Could not write %s: %v", dst, err)
+		}
+	}
+	copyFile("./test/client-cert.pem", certFile)
+	copyFile("./test/client-key.pem", keyFile)
+
+	engine := top.NewEngine("127.0.0.1", 8223, 10, 1)
+	err := engine.SetupHTTPSWithOptions(&top.TLSOptions{Cert: certFile, Key: keyFile})
+	if err != nil {
+		t.Fatalf("Expected to be able to configure polling via HTTPS. Got: %s", err)
+	}
+
+	getCert := engine.HttpClient.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate
+	before, err := getCert(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatalf("Expected client certificate, got: %v", err)
+	}
+
+	// Rotate the keypair on disk
+	copyFile("./test/server-cert.pem", certFile)
+	copyFile("./test/server-key.pem", keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	after, err := getCert(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatalf("Expected client certificate, got: %v", err)
+	}
+	if bytes.Equal(before.Certificate[0], after.Certificate[0]) {
+		t.Fatal("Expected client certificate to be reloaded after rotation")
+	}
+
+	// A broken keypair keeps the last good certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	later = later.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+
+	current, err := getCert(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatalf("Expected client certificate, got: %v", err)
+	}
+	if !bytes.Equal(after.Certificate[0], current.Certificate[0]) {
+		t.Fatal("Expected last good client certificate to be kept")
+	}
+}
+
+func TestConnectionRatesAreNormalizedByElapsedTime(t *testing.T) {
+	testcases := map[string]time.Duration{
+		"given a 500ms delay": 500 * time.Millisecond,
+		"given a 1s delay":    time.Second,
+		"given a 5s delay":    5 * time.Second,
+		"given a 30s delay":   30 * time.Second,
+	}
+
+	for name, delay := range testcases {
+		t.Run(name, func(t *testing.T) {
+			fm, engine := runFakeMonitor(t)
+
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			fm.update(func(varz *server.Varz, connz *server.Connz) {
+				varz.Now = start
+				connz.Now = start
+				connz.Conns = []*server.ConnInfo{{Cid: 1, InMsgs: 100, OutMsgs: 200, InBytes: 1000, OutBytes: 2000}}
+			})
+
+			stats := engine.FetchStatsSnapshot()
+			if stats.Rates.Connections[1].InMsgsRate != 0 || stats.Rates.ConnsElapsed != 0 {
+				t.Fatalf("Expected no rates on first poll, got: %+v", stats.Rates.Connections[1])
+			}
+
+			// Counters grow by 10 msgs/sec and 100 bytes/sec in and twice as much out.
+			// The /connz response is taken slightly after /varz.
+			secs := delay.Seconds()
+			connsDelay := delay + 10*time.Millisecond
+			connsSecs := connsDelay.Seconds()
+			fm.update(func(varz *server.Varz, connz *server.Connz) {
+				varz.Now = start.Add(delay)
+				varz.InMsgs = int64(10 * secs)
+				connz.Now = start.Add(connsDelay)
+				connz.Conns = []*server.ConnInfo{{
+					Cid:      1,
+					InMsgs:   100 + int64(10*connsSecs),
+					OutMsgs:  200 + int64(20*connsSecs),
+					InBytes:  1000 + int64(100*connsSecs),
+					OutBytes: 2000 + int64(200*connsSecs),
+				}}
+			})
+
+			stats = engine.FetchStatsSnapshot()
+			if stats.Rates.Elapsed != delay {
+				t.Fatalf("Expected elapsed %v, got: %v", delay, stats.Rates.Elapsed)
+			}
+			if stats.Rates.ConnsElapsed != connsDelay {
+				t.Fatalf("Expected connections elapsed %v, got: %v", connsDelay, stats.Rates.ConnsElapsed)
+			}
+			if got := stats.Rates.InMsgsRate; math.Abs(got-10) > 0.5 {
+				t.Errorf("Expected server in msgs rate 10, got: %v", got)
+			}
+
+			cr := stats.Rates.Connections[1]
+			for _, rate := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"in msgs", cr.InMsgsRate, 10},
+				{"out msgs", cr.OutMsgsRate, 20},
+				{"in bytes", cr.InBytesRate, 100},
+				{"out bytes", cr.OutBytesRate, 200},
+			} {
+				// Allow for the truncation of counters to whole values
+				if math.Abs(rate.got-rate.want) > 2/connsSecs {
+					t.Errorf("Expected %s rate %v, got: %v", rate.name, rate.want, rate.got)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchStatsDetectsServerRestart(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testcases := map[string]func(varz *server.Varz, connz *server.Connz){
+		"given a new server ID": func(varz *server.Varz, connz *server.Connz) {
+			varz.ID = "SRV2"
+			varz.InMsgs = 2000
+		},
+		"given uptime going backwards": func(varz *server.Varz, connz *server.Connz) {
+			varz.Start = start.Add(90 * time.Second)
+			varz.InMsgs = 2000
+		},
+		"given counters going backwards": func(varz *server.Varz, connz *server.Connz) {
+			varz.InMsgs = 5
+		},
+	}
+
+	for name, restart := range testcases {
+		t.Run(name, func(t *testing.T) {
+			fm, engine := runFakeMonitor(t)
+
+			poll := func(i int, f func(varz *server.Varz, connz *server.Connz)) *top.Stats {
+				fm.update(func(varz *server.Varz, connz *server.Connz) {
+					varz.Now = start.Add(time.Duration(i) * time.Minute)
+					connz.Now = varz.Now
+					varz.InMsgs = int64(i * 1000)
+					connz.Conns = []*server.ConnInfo{{Cid: 1, Start: start, InMsgs: int64(i * 600)}}
+					if f != nil {
+						f(varz, connz)
+					}
+				})
+				return engine.FetchStatsSnapshot()
+			}
+
+			fm.update(func(varz *server.Varz, connz *server.Connz) { varz.Start = start })
+			poll(1, nil)
+			stats := poll(2, nil)
+			if stats.Restarted || !stats.LastRestart.IsZero() {
+				t.Fatal("Expected no restart to be detected")
+			}
+			if stats.Rates.InMsgsRate <= 0 || stats.Rates.Connections[1].InMsgsRate <= 0 {
+				t.Fatalf("Expected positive rates, got: %+v", stats.Rates)
+			}
+
+			// The CID is reused by a new connection after the restart
+			stats = poll(3, func(varz *server.Varz, connz *server.Connz) {
+				restart(varz, connz)
+				connz.Conns = []*server.ConnInfo{{Cid: 1, Start: varz.Now, InMsgs: 1}}
+			})
+			if !stats.Restarted || stats.LastRestart.IsZero() {
+				t.Fatal("Expected restart to be detected")
+			}
+			if stats.Rates.InMsgsRate != 0 || stats.Rates.Connections[1].InMsgsRate != 0 {
+				t.Fatalf("Expected rates baseline to be reset, got: %+v, %+v", stats.Rates, stats.Rates.Connections[1])
+			}
+
+			stats = poll(4, func(varz *server.Varz, connz *server.Connz) {
+				restart(varz, connz)
+				varz.InMsgs += 600
+				connz.Conns = []*server.ConnInfo{{Cid: 1, Start: start.Add(3 * time.Minute), InMsgs: 601}}
+			})
+			if stats.Restarted {
+				t.Fatal("Expected restart to be reported only once")
+			}
+			if stats.LastRestart.IsZero() {
+				t.Fatal("Expected last restart to be kept")
+			}
+			if got := stats.Rates.InMsgsRate; got != 10 {
+				t.Fatalf("Expected in msgs rate of 10 after the restart, got: %v", got)
+			}
+			if got := stats.Rates.Connections[1].InMsgsRate; got != 10 {
+				t.Fatalf("Expected connection in msgs rate of 10 after the restart, got: %v", got)
+			}
+		})
+	}
+}
+
+func TestConnectionRatesIgnoreReusedCID(t *testing.T) {
+	fm, engine := runFakeMonitor(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		varz.Now, connz.Now = start, start
+		connz.Conns = []*server.ConnInfo{{Cid: 7, Start: start, InMsgs: 5000}}
+	})
+	engine.FetchStatsSnapshot()
+
+	fm.update(func(varz *server.Varz, connz *server.Connz) {
+		varz.Now, connz.Now = start.Add(time.Second), start.Add(time.Second)
+		connz.Conns = []*server.ConnInfo{{Cid: 7, Start: start.Add(500 * time.Millisecond), InMsgs: 10}}
+	})
+	stats := engine.FetchStatsSnapshot()
+	if got := stats.Rates.Connections[7].InMsgsRate; got != 0 {
+		t.Fatalf("Expected no rate for a connection reusing a CID, got: %v", got)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	testcases := map[string]struct {
+		values []float64
+		width  int
+		want   string
+	}{
+		"given no values": {
+			values: nil,
+			width:  10,
+			want:   "",
+		},
+		"given only zeros": {
+			values: []float64{0, 0, 0},
+			width:  10,
+			want:   "▁▁▁",
+		},
+		"given a growing series": {
+			values: []float64{0, 1, 2, 3, 4, 5, 6, 7},
+			width:  10,
+			want:   "▁▂▃▄▅▆▇█",
+		},
+		"given a series longer than the width": {
+			values: []float64{0, 0, 7, 7, 14, 14},
+			width:  3,
+			want:   "▁▄█",
+		},
+		"given negative values": {
+			values: []float64{-5, 10},
+			width:  10,
+			want:   "▁█",
+		},
+	}
+
+	for name, testcase := range testcases {
+		t.Run(name, func(t *testing.T) {
+			got := top.Sparkline(testcase.values, testcase.width)
+
+			if got != testcase.want {
+				t.Errorf("wanted %q, got %q", testcase.want, got)
+			}
+		})
+	}
+}